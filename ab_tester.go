@@ -0,0 +1,29 @@
+package sensorsabtest
+
+import (
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+// ABTester 是 SensorsABTest 对外提供的分流及埋点接口
+// 业务代码依赖该接口时，单元测试中可以使用 abtesttest.FakeABTester 替代真实的网络请求
+type ABTester interface {
+	// 拉取最新试验计划
+	AsyncFetchABTest(distinctId string, isLoginId bool, requestParam beans.RequestParam) (error, beans.Experiment)
+
+	// 优先从缓存获取试验变量，如果缓存没有则从网络拉取
+	FastFetchABTest(distinctId string, isLoginId bool, requestParam beans.RequestParam) (error, beans.Experiment)
+
+	// 获取用户在所有试验下的分流结果
+	FetchAllExperiments(distinctId string, isLoginId bool, requestParam beans.FetchAllRequestParam) (error, beans.AllExperimentsResult)
+
+	// 从序列化的字符串加载 AllExperimentsResult
+	LoadAllExperiments(distinctId string, isLoginId bool, param beans.LoadDumpedParam, dumpData string) (error, beans.AllExperimentsResult)
+
+	// 手动触发 $ABTestTrigger 事件
+	TrackABTestTrigger(experiment beans.Experiment, property map[string]interface{}) error
+
+	// 手动触发带自定义主体的 $ABTestTrigger 事件
+	TrackABTestTriggerWithCustomId(experiment beans.Experiment, customId map[string]string, property map[string]interface{}) error
+}
+
+var _ ABTester = (*SensorsABTest)(nil)
@@ -0,0 +1,389 @@
+// Package abtesttest 提供用于测试的 sensorsabtest.ABTester 内存实现和本地 A/B Testing 分流接口 Server
+package abtesttest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	sensorsabtest "github.com/sensorsdata/abtesting-sdk-go"
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+	"github.com/sensorsdata/abtesting-sdk-go/utils"
+)
+
+const (
+	MethodAsyncFetchABTest    = "AsyncFetchABTest"
+	MethodFastFetchABTest     = "FastFetchABTest"
+	MethodFetchAllExperiments = "FetchAllExperiments"
+	MethodLoadAllExperiments  = "LoadAllExperiments"
+)
+
+// Assignment 声明用户在某个试验参数上的分流结果
+type Assignment struct {
+	// 试验变量值，支持 string、bool 和各类整数
+	Value interface{}
+	// 试验 ID，为空时自动生成
+	ExperimentId string
+	// 试验内分组 ID，为空时为 "0"
+	GroupId string
+	// 试验结果 ID，为空时为 "0"
+	ResultId string
+	// 是否是对照组
+	IsControlGroup bool
+	// 是否白名单
+	IsWhiteList bool
+	// 是否只出现在 out_list 中，只埋点不返回试验值
+	OutList bool
+}
+
+// FetchRecord 记录一次分流请求
+type FetchRecord struct {
+	Method     string
+	DistinctId string
+	IsLoginId  bool
+	// AsyncFetchABTest、FastFetchABTest 请求的试验参数，其它方法为空
+	ParamName  string
+	CustomIDs  map[string]string
+	Properties map[string]interface{}
+}
+
+// ExposureRecord 记录一次 $ABTestTrigger 事件
+type ExposureRecord struct {
+	DistinctId string
+	IsLoginId  bool
+	ParamName  string
+	CustomIDs  map[string]string
+	Experiment beans.InnerExperiment
+	Properties map[string]interface{}
+	// 是否由 SDK 自动触发
+	Auto bool
+}
+
+// FakeABTester 是 sensorsabtest.ABTester 的内存实现，可以按用户声明试验参数，并记录所有的请求和曝光
+type FakeABTester struct {
+	lock        sync.Mutex
+	defaults    map[string]Assignment
+	users       map[string]map[string]Assignment
+	err         error
+	fetches     []FetchRecord
+	exposures   []ExposureRecord
+	trackConfig beans.TrackConfig
+}
+
+var _ sensorsabtest.ABTester = (*FakeABTester)(nil)
+
+// NewFakeABTester 创建一个没有任何试验的 FakeABTester
+func NewFakeABTester() *FakeABTester {
+	return &FakeABTester{
+		defaults: make(map[string]Assignment),
+		users:    make(map[string]map[string]Assignment),
+		trackConfig: beans.TrackConfig{
+			TriggerSwitch:     true,
+			TriggerContentExt: []string{"abtest_experiment_result_id", "abtest_experiment_version"},
+		},
+	}
+}
+
+// SetParam 为所有用户声明试验参数的值
+func (fake *FakeABTester) SetParam(paramName string, value interface{}) {
+	fake.SetAssignment(paramName, Assignment{Value: value})
+}
+
+// SetAssignment 为所有用户声明试验参数的分流结果
+func (fake *FakeABTester) SetAssignment(paramName string, assignment Assignment) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.defaults[paramName] = fillAssignment(paramName, assignment)
+}
+
+// SetUserParam 为指定用户声明试验参数的值，优先级高于 SetParam
+func (fake *FakeABTester) SetUserParam(distinctId string, paramName string, value interface{}) {
+	fake.SetUserAssignment(distinctId, paramName, Assignment{Value: value})
+}
+
+// SetUserAssignment 为指定用户声明试验参数的分流结果，优先级高于 SetAssignment
+func (fake *FakeABTester) SetUserAssignment(distinctId string, paramName string, assignment Assignment) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	if fake.users[distinctId] == nil {
+		fake.users[distinctId] = make(map[string]Assignment)
+	}
+	fake.users[distinctId][paramName] = fillAssignment(paramName, assignment)
+}
+
+// SetError 设置后所有的分流请求都返回该错误和默认值，传入 nil 恢复正常
+func (fake *FakeABTester) SetError(err error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.err = err
+}
+
+// Fetches 返回所有分流请求的记录
+func (fake *FakeABTester) Fetches() []FetchRecord {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	return append([]FetchRecord(nil), fake.fetches...)
+}
+
+// Exposures 返回所有 $ABTestTrigger 事件的记录
+func (fake *FakeABTester) Exposures() []ExposureRecord {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	return append([]ExposureRecord(nil), fake.exposures...)
+}
+
+// Reset 清空请求和曝光记录，保留声明的试验参数
+func (fake *FakeABTester) Reset() {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.fetches = nil
+	fake.exposures = nil
+}
+
+func (fake *FakeABTester) AsyncFetchABTest(distinctId string, isLoginId bool, requestParam beans.RequestParam) (error, beans.Experiment) {
+	return fake.fetchABTest(MethodAsyncFetchABTest, distinctId, isLoginId, requestParam)
+}
+
+func (fake *FakeABTester) FastFetchABTest(distinctId string, isLoginId bool, requestParam beans.RequestParam) (error, beans.Experiment) {
+	return fake.fetchABTest(MethodFastFetchABTest, distinctId, isLoginId, requestParam)
+}
+
+func (fake *FakeABTester) fetchABTest(method string, distinctId string, isLoginId bool, requestParam beans.RequestParam) (error, beans.Experiment) {
+	fake.recordFetch(FetchRecord{
+		Method:     method,
+		DistinctId: distinctId,
+		IsLoginId:  isLoginId,
+		ParamName:  requestParam.ParamName,
+		CustomIDs:  requestParam.CustomIDs,
+		Properties: requestParam.Properties,
+	})
+	if distinctId == "" {
+		return errors.New("DistinctId must not be empty"), beans.Experiment{Result: requestParam.DefaultValue}
+	}
+	if requestParam.ParamName == "" {
+		return errors.New("RequestParam.ParamName must not be empty"), beans.Experiment{Result: requestParam.DefaultValue}
+	}
+	if err := fake.getError(); err != nil {
+		return err, beans.Experiment{Result: requestParam.DefaultValue}
+	}
+
+	experiment := beans.Experiment{
+		DistinctId: distinctId,
+		IsLoginId:  isLoginId,
+		CustomIDs:  requestParam.CustomIDs,
+		Result:     requestParam.DefaultValue,
+	}
+	assignment, ok := fake.lookup(distinctId, requestParam.ParamName)
+	if !ok {
+		return nil, experiment
+	}
+
+	// 与 SDK 一致，类型与默认值不一致时视为没有命中试验，返回默认值并且不曝光
+	if reflect.TypeOf(assignment.Value) != reflect.TypeOf(requestParam.DefaultValue) {
+		return nil, experiment
+	}
+	innerExperiment := buildInnerExperiment(requestParam.ParamName, assignment)
+	if requestParam.EnableAutoTrackABEvent {
+		fake.recordExposure(distinctId, isLoginId, requestParam.ParamName, requestParam.CustomIDs, innerExperiment, nil, true)
+	}
+	// out_list 中的试验仍然曝光，但返回默认值
+	if assignment.OutList {
+		return nil, experiment
+	}
+	experiment.Result = assignment.Value
+	experiment.InternalExperiment = innerExperiment
+	return nil, experiment
+}
+
+func (fake *FakeABTester) FetchAllExperiments(distinctId string, isLoginId bool, requestParam beans.FetchAllRequestParam) (error, beans.AllExperimentsResult) {
+	fake.recordFetch(FetchRecord{
+		Method:     MethodFetchAllExperiments,
+		DistinctId: distinctId,
+		IsLoginId:  isLoginId,
+		CustomIDs:  requestParam.CustomIDs,
+		Properties: requestParam.Properties,
+	})
+	if distinctId == "" {
+		return errors.New("DistinctId must not be empty"), beans.AllExperimentsResult{}
+	}
+	if err := fake.getError(); err != nil {
+		return err, beans.NewAllExperimentsResultBuilder().
+			DistinctId(distinctId).
+			IsLoginId(isLoginId).
+			CustomIDs(requestParam.CustomIDs).
+			Experiments(make(map[string]beans.InnerExperiment)).
+			Timestamp(time.Now().UnixMilli()).Build()
+	}
+
+	response := utils.Response{Status: "SUCCESS", TrackConfig: fake.trackConfig}
+	for paramName, assignment := range fake.assignments(distinctId) {
+		innerExperiment := buildInnerExperiment(paramName, assignment)
+		// 试验值只通过 variables 传递，与服务端响应保持一致
+		innerExperiment.Result = nil
+		if assignment.OutList {
+			response.OutList = append(response.OutList, innerExperiment)
+		} else {
+			response.Results = append(response.Results, innerExperiment)
+		}
+	}
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		return err, beans.AllExperimentsResult{}
+	}
+
+	return nil, fake.buildAllExperimentsResult(distinctId, isLoginId, requestParam.CustomIDs, response, string(responseBody), time.Now().UnixMilli(), requestParam.EnableAutoTrackABEvent)
+}
+
+func (fake *FakeABTester) LoadAllExperiments(distinctId string, isLoginId bool, param beans.LoadDumpedParam, dumpData string) (error, beans.AllExperimentsResult) {
+	fake.recordFetch(FetchRecord{
+		Method:     MethodLoadAllExperiments,
+		DistinctId: distinctId,
+		IsLoginId:  isLoginId,
+		CustomIDs:  param.CustomIDs,
+		Properties: param.Properties,
+	})
+	data, err := beans.DecodeDumpData(dumpData)
+	if err != nil {
+		return err, beans.AllExperimentsResult{}
+	}
+	if data.DistinctId != distinctId || data.IsLoginId != isLoginId {
+		return errors.New("user identity (distinctId, isLoginId) mismatch"), beans.AllExperimentsResult{}
+	}
+	if !utils.CompareMaps(data.CustomIDs, param.CustomIDs) {
+		return errors.New("user identity (CustomIDs) mismatch"), beans.AllExperimentsResult{}
+	}
+	response, err := utils.ParseResponse(data.ResponseBody)
+	if err != nil {
+		return err, beans.AllExperimentsResult{}
+	}
+
+	return nil, fake.buildAllExperimentsResult(distinctId, isLoginId, data.CustomIDs, response, data.ResponseBody, data.Timestamp, param.EnableAutoTrackABEvent)
+}
+
+func (fake *FakeABTester) TrackABTestTrigger(experiment beans.Experiment, property map[string]interface{}) error {
+	return fake.TrackABTestTriggerWithCustomId(experiment, nil, property)
+}
+
+func (fake *FakeABTester) TrackABTestTriggerWithCustomId(experiment beans.Experiment, customId map[string]string, property map[string]interface{}) error {
+	if experiment.DistinctId == "" {
+		return errors.New("DistinctId must not be empty")
+	}
+	var paramName string
+	if len(experiment.InternalExperiment.VariableList) > 0 {
+		paramName = experiment.InternalExperiment.VariableList[0].Name
+	}
+	fake.recordExposure(experiment.DistinctId, experiment.IsLoginId, paramName, customId, experiment.InternalExperiment, property, false)
+	return nil
+}
+
+// 使用 SDK 的 BuildAllExperimentsResult 构建结果，曝光记录到 Exposures
+func (fake *FakeABTester) buildAllExperimentsResult(distinctId string, isLoginId bool, customIDs map[string]string, response utils.Response, responseBody string, timestamp int64, enableAutoTrack bool) beans.AllExperimentsResult {
+	return sensorsabtest.BuildAllExperimentsResult(sensorsabtest.BuildAllExperimentsResultParams{
+		ExperimentResponse:     response,
+		RawResponseBody:        responseBody,
+		DistinctId:             distinctId,
+		IsLoginId:              isLoginId,
+		CustomIDs:              customIDs,
+		EnableAutoTrackABEvent: enableAutoTrack,
+		Timestamp:              timestamp,
+	}, func(paramName string, experiment beans.InnerExperiment) {
+		fake.recordExposure(distinctId, isLoginId, paramName, customIDs, experiment, nil, true)
+	})
+}
+
+func (fake *FakeABTester) recordFetch(record FetchRecord) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.fetches = append(fake.fetches, record)
+}
+
+func (fake *FakeABTester) recordExposure(distinctId string, isLoginId bool, paramName string, customIDs map[string]string, experiment beans.InnerExperiment, properties map[string]interface{}, auto bool) {
+	// 与 SDK 一致，白名单用户不触发 $ABTestTrigger 事件
+	if experiment.IsWhiteList {
+		return
+	}
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.exposures = append(fake.exposures, ExposureRecord{
+		DistinctId: distinctId,
+		IsLoginId:  isLoginId,
+		ParamName:  paramName,
+		CustomIDs:  customIDs,
+		Experiment: experiment,
+		Properties: properties,
+		Auto:       auto,
+	})
+}
+
+func (fake *FakeABTester) getError() error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	return fake.err
+}
+
+func (fake *FakeABTester) lookup(distinctId string, paramName string) (Assignment, bool) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	if assignment, ok := fake.users[distinctId][paramName]; ok {
+		return assignment, true
+	}
+	assignment, ok := fake.defaults[paramName]
+	return assignment, ok
+}
+
+func (fake *FakeABTester) assignments(distinctId string) map[string]Assignment {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	assignments := make(map[string]Assignment, len(fake.defaults)+len(fake.users[distinctId]))
+	for paramName, assignment := range fake.defaults {
+		assignments[paramName] = assignment
+	}
+	for paramName, assignment := range fake.users[distinctId] {
+		assignments[paramName] = assignment
+	}
+	return assignments
+}
+
+func fillAssignment(paramName string, assignment Assignment) Assignment {
+	if assignment.ExperimentId == "" {
+		assignment.ExperimentId = "fake_" + paramName
+	}
+	if assignment.GroupId == "" {
+		assignment.GroupId = "0"
+	}
+	if assignment.ResultId == "" {
+		assignment.ResultId = "0"
+	}
+	return assignment
+}
+
+func buildInnerExperiment(paramName string, assignment Assignment) beans.InnerExperiment {
+	return beans.InnerExperiment{
+		AbtestExperimentId:       assignment.ExperimentId,
+		AbtestExperimentGroupId:  assignment.GroupId,
+		AbtestExperimentResultId: assignment.ResultId,
+		IsControlGroup:           assignment.IsControlGroup,
+		IsWhiteList:              assignment.IsWhiteList,
+		Cacheable:                true,
+		VariableList: []beans.Variables{{
+			Name:  paramName,
+			Value: fmt.Sprintf("%v", assignment.Value),
+			Type:  variableType(assignment.Value),
+		}},
+		Result: assignment.Value,
+	}
+}
+
+func variableType(value interface{}) string {
+	switch value.(type) {
+	case bool:
+		return "BOOLEAN"
+	case int, int8, int16, int32, int64:
+		return "INTEGER"
+	default:
+		return "STRING"
+	}
+}
@@ -0,0 +1,86 @@
+package abtesttest
+
+import (
+	"testing"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+func TestFakeFetchAllExperimentsDumpAndLoad(t *testing.T) {
+	fake := NewFakeABTester()
+	fake.SetParam("color", "red")
+	fake.SetUserParam("user", "count", 3)
+	fake.SetAssignment("hidden", Assignment{Value: true, OutList: true})
+
+	err, result := fake.FetchAllExperiments("user", true, beans.FetchAllRequestParam{EnableAutoTrackABEvent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := result.GetValue("color", "blue"); value != "red" {
+		t.Fatalf("color = %v", value)
+	}
+	if value := result.GetValue("count", 0); value != 3 {
+		t.Fatalf("count = %v", value)
+	}
+	// out_list 中的参数返回默认值，但仍然曝光
+	if value := result.GetValue("hidden", false); value != false {
+		t.Fatalf("hidden = %v", value)
+	}
+	exposures := fake.Exposures()
+	if len(exposures) != 3 || exposures[2].ParamName != "hidden" || !exposures[2].Auto {
+		t.Fatalf("exposures = %+v", exposures)
+	}
+
+	dump, err := result.DumpWithFormat(beans.DumpFormatGzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err, loaded := fake.LoadAllExperiments("user", true, beans.LoadDumpedParam{}, dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := loaded.GetValue("count", 0); value != 3 {
+		t.Fatalf("loaded count = %v", value)
+	}
+	if len(fake.Exposures()) != 3 {
+		t.Fatal("auto tracking should be disabled when loading without EnableAutoTrackABEvent")
+	}
+}
+
+func TestFakeFetchABTestExposure(t *testing.T) {
+	fake := NewFakeABTester()
+	fake.SetParam("color", "red")
+	fake.SetAssignment("hidden", Assignment{Value: "green", OutList: true})
+
+	tests := []struct {
+		paramName    string
+		defaultValue interface{}
+		want         interface{}
+		exposed      bool
+	}{
+		{paramName: "color", defaultValue: "blue", want: "red", exposed: true},
+		// 类型不一致时视为没有命中试验，不曝光
+		{paramName: "color", defaultValue: 0, want: 0},
+		// out_list 中的试验返回默认值，但仍然曝光
+		{paramName: "hidden", defaultValue: "blue", want: "blue", exposed: true},
+		{paramName: "hidden", defaultValue: false, want: false},
+		{paramName: "missing", defaultValue: "blue", want: "blue"},
+	}
+	for _, test := range tests {
+		before := len(fake.Exposures())
+		err, experiment := fake.AsyncFetchABTest("user", true, beans.RequestParam{
+			ParamName:              test.paramName,
+			DefaultValue:           test.defaultValue,
+			EnableAutoTrackABEvent: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if experiment.Result != test.want {
+			t.Errorf("%s with default %v: result = %v, want %v", test.paramName, test.defaultValue, experiment.Result, test.want)
+		}
+		if exposed := len(fake.Exposures()) > before; exposed != test.exposed {
+			t.Errorf("%s with default %v: exposed = %v, want %v", test.paramName, test.defaultValue, exposed, test.exposed)
+		}
+	}
+}
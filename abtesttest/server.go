@@ -0,0 +1,243 @@
+package abtesttest
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+// Fixture 声明 Server 对匹配请求返回的响应
+type Fixture struct {
+	// 匹配的用户标识（login_id 或 anonymous_id），为空时匹配所有用户
+	DistinctId string
+	// 自定义匹配条件，与 DistinctId 同时设置时需要同时满足
+	Match func(request ServerRequest) bool
+
+	// 命中的试验
+	Results []beans.InnerExperiment
+	// out_list 中的试验
+	OutList []beans.InnerExperiment
+	// 埋点配置，为 nil 时响应中不包含 track_config，由 SDK 使用默认配置
+	TrackConfig *beans.TrackConfig
+
+	// 不为空时返回 status 为 FAILED 的错误响应
+	Error     string
+	ErrorType string
+
+	// HTTP 状态码，默认 200
+	StatusCode int
+	// 响应延迟，用于模拟超时
+	Latency time.Duration
+	// 不为空时直接作为响应体返回，用于模拟非法的响应
+	RawBody string
+	// 额外的响应 Header
+	Headers map[string]string
+}
+
+// ServerRequest 记录 Server 收到的一次请求
+type ServerRequest struct {
+	DistinctId string
+	IsLoginId  bool
+	CustomIDs  map[string]string
+	Properties map[string]interface{}
+	// 原始请求参数，即 buildRequestParam、buildGetAllRequestParam 构建的内容
+	Params map[string]interface{}
+	Header http.Header
+}
+
+// Server 是基于 httptest 的 A/B Testing 分流接口，按照声明的 Fixture 返回响应
+type Server struct {
+	*httptest.Server
+
+	lock           sync.Mutex
+	fixtures       []Fixture
+	defaultFixture Fixture
+	requests       []ServerRequest
+	requestCount   int
+}
+
+// NewServer 启动一个 Server，请求按照声明顺序匹配 fixtures，都不匹配时返回空的成功响应
+func NewServer(fixtures ...Fixture) *Server {
+	server := &Server{fixtures: fixtures}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.handle))
+	return server
+}
+
+// AddFixture 追加一个 Fixture，后追加的优先级更低
+func (server *Server) AddFixture(fixture Fixture) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.fixtures = append(server.fixtures, fixture)
+}
+
+// SetDefault 设置所有 Fixture 都不匹配时返回的响应
+func (server *Server) SetDefault(fixture Fixture) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.defaultFixture = fixture
+}
+
+// Requests 返回收到的所有请求
+func (server *Server) Requests() []ServerRequest {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return append([]ServerRequest(nil), server.requests...)
+}
+
+// Reset 清空 Fixture 和请求记录
+func (server *Server) Reset() {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.fixtures = nil
+	server.defaultFixture = Fixture{}
+	server.requests = nil
+}
+
+func (server *Server) handle(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var reader io.Reader = request.Body
+	// 和分流接口一样接受 gzip 压缩的请求体
+	if strings.EqualFold(request.Header.Get("Content-Encoding"), "gzip") {
+		gzipReader, err := gzip.NewReader(request.Body)
+		if err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reader = gzipReader
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var params map[string]interface{}
+	if err = json.Unmarshal(body, &params); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	serverRequest := parseServerRequest(params, request.Header)
+	fixture, requestId := server.match(serverRequest)
+
+	if fixture.Latency > 0 {
+		select {
+		case <-time.After(fixture.Latency):
+		case <-request.Context().Done():
+			return
+		}
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("X-AB-Request-Id", requestId)
+	for key, value := range fixture.Headers {
+		writer.Header().Set(key, value)
+	}
+	statusCode := fixture.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	writer.WriteHeader(statusCode)
+
+	if fixture.RawBody != "" {
+		_, _ = writer.Write([]byte(fixture.RawBody))
+		return
+	}
+	_, _ = writer.Write(buildFixtureBody(fixture))
+}
+
+func (server *Server) match(request ServerRequest) (Fixture, string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.requests = append(server.requests, request)
+	server.requestCount++
+	requestId := fmt.Sprintf("abtesttest-%d", server.requestCount)
+
+	for _, fixture := range server.fixtures {
+		if fixture.DistinctId != "" && fixture.DistinctId != request.DistinctId {
+			continue
+		}
+		if fixture.Match != nil && !fixture.Match(request) {
+			continue
+		}
+		return fixture, requestId
+	}
+	return server.defaultFixture, requestId
+}
+
+func parseServerRequest(params map[string]interface{}, header http.Header) ServerRequest {
+	request := ServerRequest{Params: params, Header: header}
+	if loginId, ok := params["login_id"].(string); ok {
+		request.DistinctId = loginId
+		request.IsLoginId = true
+	} else if anonymousId, ok := params["anonymous_id"].(string); ok {
+		request.DistinctId = anonymousId
+	}
+	if properties, ok := params["custom_properties"].(map[string]interface{}); ok {
+		request.Properties = properties
+	}
+	if customIds, ok := params["custom_ids"].(map[string]interface{}); ok {
+		request.CustomIDs = make(map[string]string, len(customIds))
+		for key, value := range customIds {
+			request.CustomIDs[key] = fmt.Sprintf("%v", value)
+		}
+	}
+	return request
+}
+
+func buildFixtureBody(fixture Fixture) []byte {
+	body := make(map[string]interface{})
+	if fixture.Error != "" {
+		body["status"] = "FAILED"
+		body["error"] = fixture.Error
+		body["error_type"] = fixture.ErrorType
+	} else {
+		body["status"] = "SUCCESS"
+		body["results"] = buildFixtureExperiments(fixture.Results)
+		body["out_list"] = buildFixtureExperiments(fixture.OutList)
+		if fixture.TrackConfig != nil {
+			body["track_config"] = fixture.TrackConfig
+		}
+	}
+	data, _ := json.Marshal(body)
+	return data
+}
+
+// 只输出服务端响应中的字段，TrackExtValue 按照 trigger_content_ext 的格式展开
+func buildFixtureExperiments(experiments []beans.InnerExperiment) []map[string]interface{} {
+	items := make([]map[string]interface{}, 0, len(experiments))
+	for _, experiment := range experiments {
+		item := map[string]interface{}{
+			"abtest_experiment_id":        experiment.AbtestExperimentId,
+			"abtest_experiment_group_id":  experiment.AbtestExperimentGroupId,
+			"abtest_experiment_result_id": experiment.AbtestExperimentResultId,
+			"abtest_experiment_version":   experiment.AbtestExperimentVersion,
+			"experiment_type":             experiment.ExperimentType,
+			"subject_name":                experiment.SubjectName,
+			"subject_id":                  experiment.SubjectId,
+			"stickiness":                  experiment.Stickiness,
+			"cacheable":                   experiment.Cacheable,
+			"is_control_group":            experiment.IsControlGroup,
+			"is_white_list":               experiment.IsWhiteList,
+			"variables":                   experiment.VariableList,
+		}
+		for key, value := range experiment.TrackExtValue {
+			if _, exists := item[key]; !exists {
+				item[key] = value
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
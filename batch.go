@@ -0,0 +1,143 @@
+package sensorsabtest
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+	"github.com/sensorsdata/abtesting-sdk-go/utils"
+)
+
+/*
+批量获取用户在所有试验下的分流结果
+结果按完成顺序通过 channel 返回，全部完成或 ctx 结束后关闭 channel，ctx 结束后尚未处理的用户不再返回结果，正在进行的网络请求会被取消
+*/
+func (sensors *SensorsABTest) FetchAllExperimentsBatch(ctx context.Context, users []beans.UserRef, opts beans.BatchFetchOptions) <-chan beans.BatchFetchResult {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 8
+	}
+
+	results := make(chan beans.BatchFetchResult, concurrency)
+	limiter := utils.NewRateLimiter(opts.RequestsPerSecond)
+
+	workers := runConcurrently(ctx, len(users), concurrency, func(index int) {
+		result := sensors.fetchAllForBatch(ctx, index, users[index], opts, limiter)
+		select {
+		case results <- result:
+		case <-ctx.Done():
+		}
+	})
+
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// 以有限的并发执行 count 个任务，ctx 结束后不再分发新的任务，返回的 WaitGroup 在所有任务结束后完成
+func runConcurrently(ctx context.Context, count int, concurrency int, task func(index int)) *sync.WaitGroup {
+	if concurrency > count {
+		concurrency = count
+	}
+	indexes := make(chan int)
+	workers := &sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for index := range indexes {
+				task(index)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(indexes)
+		for index := 0; index < count; index++ {
+			select {
+			case indexes <- index:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return workers
+}
+
+func (sensors *SensorsABTest) fetchAllForBatch(ctx context.Context, index int, user beans.UserRef, opts beans.BatchFetchOptions, limiter *utils.RateLimiter) beans.BatchFetchResult {
+	batchResult := beans.BatchFetchResult{
+		Index: index,
+		User:  user,
+	}
+
+	idKey := getExperimentUserKey(user.DistinctId, user.CustomIDs, user.IsLoginId)
+	if opts.UseCache && user.DistinctId != "" {
+		result, ok := sensors.loadAllExperimentsFromCache(idKey, user, opts.EnableAutoTrackABEvent)
+		if ok {
+			batchResult.Result = result
+			batchResult.FromCache = true
+			return batchResult
+		}
+	}
+
+	// 只有网络请求受限流控制
+	err := limiter.Wait(ctx)
+	if err != nil {
+		batchResult.Err = err
+		return batchResult
+	}
+
+	requestParam := beans.FetchAllRequestParam{
+		Properties:             user.Properties,
+		CustomIDs:              user.CustomIDs,
+		TimeoutMilliseconds:    opts.TimeoutMilliseconds,
+		EnableAutoTrackABEvent: opts.EnableAutoTrackABEvent,
+	}
+	err, result, response := sensors.fetchAllExperiments(ctx, user.DistinctId, user.IsLoginId, requestParam)
+	if err == nil && opts.UseCache {
+		// 与 prefetch 相同，缓存试验时同时保存埋点配置，缓存命中时按照该配置触发埋点
+		setTrackConfig(response.TrackConfig)
+		saveExperiment2Cache(idKey, response.Results)
+	}
+	batchResult.Result = result
+	batchResult.Err = err
+	return batchResult
+}
+
+// 从试验缓存构建 AllExperimentsResult，缓存不存在或已过期时返回 false
+func (sensors *SensorsABTest) loadAllExperimentsFromCache(idKey string, user beans.UserRef, enableAutoTrackABEvent bool) (beans.AllExperimentsResult, bool) {
+	if isExperimentExpired(idKey, sensors.getConfig().ExperimentCacheTime) {
+		return beans.AllExperimentsResult{}, false
+	}
+	experiments, ok := loadExperimentCache(idKey)
+	if !ok {
+		return beans.AllExperimentsResult{}, false
+	}
+
+	response := utils.Response{
+		Status:      "SUCCESS",
+		TrackConfig: getTrackConfig(),
+	}
+	for _, experiment := range experiments.([]beans.InnerExperiment) {
+		if experiment.AbtestExperimentId != "" {
+			response.Results = append(response.Results, experiment)
+		}
+	}
+	// 为缓存的结果生成响应体，保证 Dump 后可以被 LoadAllExperiments 加载
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		return beans.AllExperimentsResult{}, false
+	}
+
+	return sensors.buildAllExperimentsResult(BuildAllExperimentsResultParams{
+		ExperimentResponse:     response,
+		RawResponseBody:        string(responseBody),
+		DistinctId:             user.DistinctId,
+		IsLoginId:              user.IsLoginId,
+		CustomIDs:              user.CustomIDs,
+		EnableAutoTrackABEvent: enableAutoTrackABEvent,
+	}), true
+}
@@ -0,0 +1,165 @@
+package sensorsabtest_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sensorsabtest "github.com/sensorsdata/abtesting-sdk-go"
+	"github.com/sensorsdata/abtesting-sdk-go/abtesttest"
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+// 记录同时进行的请求数的最大值
+type concurrencyTransport struct {
+	inFlight int32
+	max      int32
+}
+
+func (transport *concurrencyTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	current := atomic.AddInt32(&transport.inFlight, 1)
+	defer atomic.AddInt32(&transport.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&transport.max)
+		if current <= max || atomic.CompareAndSwapInt32(&transport.max, max, current) {
+			break
+		}
+	}
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+func batchUsers(prefix string, count int) []beans.UserRef {
+	users := make([]beans.UserRef, count)
+	for i := range users {
+		users[i] = beans.UserRef{DistinctId: fmt.Sprintf("%s_%d", prefix, i), IsLoginId: true}
+	}
+	return users
+}
+
+func TestFetchAllExperimentsBatchLimitsConcurrency(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{
+		Results: []beans.InnerExperiment{testExperiment("exp_batch", "color", "red", "STRING")},
+		Latency: 20 * time.Millisecond,
+	})
+	defer server.Close()
+	transport := &concurrencyTransport{}
+	sensors, events := newTestSDK(t, server, sensorsabtest.WithRoundTripper(transport))
+
+	users := batchUsers("limit", 12)
+	count := 0
+	for result := range sensors.FetchAllExperimentsBatch(context.Background(), users, beans.BatchFetchOptions{Concurrency: 3}) {
+		if result.Err != nil || result.FromCache {
+			t.Fatalf("result %d: err = %v, fromCache = %v", result.Index, result.Err, result.FromCache)
+		}
+		// 关闭自动埋点时读取参数不会触发 $ABTestTrigger
+		if value := result.Result.GetValue("color", "blue"); value != "red" {
+			t.Fatalf("result %d: color = %v", result.Index, value)
+		}
+		count++
+	}
+	if count != len(users) {
+		t.Fatalf("expected %d results, got %d", len(users), count)
+	}
+	if max := atomic.LoadInt32(&transport.max); max > 3 || max < 2 {
+		t.Fatalf("max concurrent requests = %d", max)
+	}
+	if len(events()) != 0 {
+		t.Fatalf("auto tracking is off, events = %+v", events())
+	}
+}
+
+func TestFetchAllExperimentsBatchUsesCache(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{
+		Results: []beans.InnerExperiment{testExperiment("exp_batch_cache", "color", "red", "STRING")},
+	})
+	defer server.Close()
+	sensors, events := newTestSDK(t, server)
+
+	users := batchUsers("cache", 5)
+	opts := beans.BatchFetchOptions{UseCache: true, EnableAutoTrackABEvent: true}
+	for result := range sensors.FetchAllExperimentsBatch(context.Background(), users, opts) {
+		if result.Err != nil || result.FromCache {
+			t.Fatalf("first batch result %d: err = %v, fromCache = %v", result.Index, result.Err, result.FromCache)
+		}
+	}
+	if len(server.Requests()) != len(users) {
+		t.Fatalf("expected %d requests, got %d", len(users), len(server.Requests()))
+	}
+
+	for result := range sensors.FetchAllExperimentsBatch(context.Background(), users, opts) {
+		if result.Err != nil || !result.FromCache {
+			t.Fatalf("second batch result %d: err = %v, fromCache = %v", result.Index, result.Err, result.FromCache)
+		}
+		if value := result.Result.GetValue("color", "blue"); value != "red" {
+			t.Fatalf("cached color = %v", value)
+		}
+	}
+	if len(server.Requests()) != len(users) {
+		t.Fatal("second batch should be served from the cache")
+	}
+	if len(events()) != len(users) {
+		t.Fatalf("expected %d events from cached results, got %d", len(users), len(events()))
+	}
+}
+
+func TestFetchAllExperimentsBatchCancelsInFlightRequests(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{Latency: 5 * time.Second})
+	defer server.Close()
+	sensors, _ := newTestSDK(t, server, sensorsabtest.WithRequestTimeout(10*time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := sensors.FetchAllExperimentsBatch(ctx, batchUsers("cancel", 4), beans.BatchFetchOptions{Concurrency: 4, TimeoutMilliseconds: 10000})
+	time.Sleep(50 * time.Millisecond)
+	startTime := time.Now()
+	cancel()
+	for range results {
+	}
+	if elapsed := time.Since(startTime); elapsed > time.Second {
+		t.Fatalf("batch took %v to stop after cancel", elapsed)
+	}
+}
+
+func TestFetchAllExperimentsBatchCacheKeepsTrackConfig(t *testing.T) {
+	experiment := testExperiment("exp_batch_track", "color", "red", "STRING")
+	experiment.SubjectId = "subject"
+	experiment.SubjectName = "USER"
+	server := abtesttest.NewServer(
+		// 先关闭触发开关，避免使用其他测试保存的埋点配置
+		abtesttest.Fixture{DistinctId: "switch_off", TrackConfig: &beans.TrackConfig{}},
+		abtesttest.Fixture{
+			Results:     []beans.InnerExperiment{experiment},
+			TrackConfig: &beans.TrackConfig{TriggerSwitch: true, PropertySetSwitch: true},
+		})
+	defer server.Close()
+	sensors, events := newTestSDK(t, server)
+	if err, _ := sensors.FetchAllExperiments("switch_off", true, beans.FetchAllRequestParam{}); err != nil {
+		t.Fatal(err)
+	}
+
+	users := batchUsers("track", 3)
+	for result := range sensors.FetchAllExperimentsBatch(context.Background(), users, beans.BatchFetchOptions{UseCache: true}) {
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+	}
+	// 缓存命中时使用缓存试验时保存的埋点配置
+	opts := beans.BatchFetchOptions{UseCache: true, EnableAutoTrackABEvent: true}
+	for result := range sensors.FetchAllExperimentsBatch(context.Background(), users, opts) {
+		if result.Err != nil || !result.FromCache {
+			t.Fatalf("result %d: err = %v, fromCache = %v", result.Index, result.Err, result.FromCache)
+		}
+		result.Result.GetValue("color", "blue")
+	}
+	tracked := events()
+	if len(tracked) != len(users) {
+		t.Fatalf("expected %d events from cached results, got %d", len(users), len(tracked))
+	}
+	for _, event := range tracked {
+		if _, ok := event.Properties["abtest_result"]; !ok {
+			t.Fatalf("PropertySetSwitch of the cached track config is ignored: %+v", event.Properties)
+		}
+	}
+}
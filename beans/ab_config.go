@@ -1,10 +1,15 @@
 package beans
 
 import (
-	"github.com/sensorsdata/sa-sdk-go"
+	"errors"
+	"net/http"
 	"time"
+
+	"github.com/sensorsdata/sa-sdk-go"
 )
 
+// ABTestConfig 是 InitSensorsABTest 的配置，不合法的值会被修正为默认值
+// 新代码推荐使用 sensorsabtest.New 和 Option，缓存时间为真实的 time.Duration 并且会校验配置
 type ABTestConfig struct {
 	/*
 		试验缓存时间，单位是分钟
@@ -39,11 +44,62 @@ type ABTestConfig struct {
 	*/
 	APIUrl string
 
+	/*
+		多个分流接口地址和选择策略，默认只使用 APIUrl
+	*/
+	EndpointParam EndpointParam
+
+	/*
+		对冲请求，默认关闭
+	*/
+	HedgingParam HedgingParam
+
 	/*
 		HTTP连接参数
 	*/
 	HTTPTransportParam HTTPTransportParam
 
+	/*
+		自定义 HTTP 客户端和请求 Header，设置 Client 或 Transport 后 HTTPTransportParam 不再生效
+	*/
+	HTTPClientParam HTTPClientParam
+
+	/*
+		请求参数中未设置超时时间时使用的网络请求超时时间，单位 ms，默认 3s
+	*/
+	RequestTimeoutMilliseconds int
+
+	/*
+		网络请求失败后的重试参数，默认不重试
+	*/
+	RetryParam RetryParam
+
+	/*
+		请求体和响应体的 gzip 压缩，默认不压缩
+	*/
+	CompressionParam CompressionParam
+
+	/*
+		响应体大小限制和 Content-Type 校验
+	*/
+	ResponseParam ResponseParam
+
+	/*
+		每次网络请求结束后的回调，可以用于统计耗时、状态码和压缩率
+	*/
+	OnRequestObserved func(observation RequestObservation)
+
+	/*
+		请求录制回放参数，用于线下复现线上的分流结果
+	*/
+	CassetteParam CassetteParam
+
+	/*
+		试验版本变化时的回调，oldVersion 为空表示首次发现该试验
+		试验版本在所有 SensorsABTest 之间共享，只有收到新版本响应的实例会回调
+	*/
+	OnExperimentVersionChange func(experimentId string, oldVersion string, newVersion string)
+
 	/**
 	用于 SDK 埋点 SensorsAnalytics
 	*/
@@ -57,4 +113,144 @@ type HTTPTransportParam struct {
 	IdleConnTimeoutMilliSeconds int
 	DialTimeoutMilliSeconds     int
 	DialKeepAliveMilliSeconds   int
+
+	// 私有 CA 证书文件，PEM 格式，可以包含多个证书；为空时使用系统 CA
+	CAFile string
+	// mTLS 客户端证书和私钥文件，PEM 格式，需要同时设置
+	CertFile string
+	KeyFile  string
+	// 代理地址，支持 http://、https:// 和 socks5://，为空时不使用代理
+	ProxyURL string
+	// 仅用于测试：跳过服务端证书校验，生产环境不要开启
+	InsecureSkipVerifyForTestingOnly bool
+}
+
+// 分流接口地址的选择策略
+type EndpointPolicy int
+
+const (
+	// 按照顺序使用第一个健康的地址，APIUrl 为主地址
+	EndpointPolicyFailover EndpointPolicy = iota
+	// 在健康的地址之间轮询
+	EndpointPolicyRoundRobin
+	// 使用平均耗时最低的健康地址
+	EndpointPolicyLowestLatency
+)
+
+func (policy EndpointPolicy) String() string {
+	switch policy {
+	case EndpointPolicyFailover:
+		return "failover"
+	case EndpointPolicyRoundRobin:
+		return "round_robin"
+	case EndpointPolicyLowestLatency:
+		return "lowest_latency"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseEndpointPolicy 解析 failover、round_robin 和 lowest_latency
+func ParseEndpointPolicy(value string) (EndpointPolicy, error) {
+	for _, policy := range []EndpointPolicy{EndpointPolicyFailover, EndpointPolicyRoundRobin, EndpointPolicyLowestLatency} {
+		if value == policy.String() {
+			return policy, nil
+		}
+	}
+	return EndpointPolicyFailover, errors.New("unknown endpoint policy " + value + ", expected failover, round_robin or lowest_latency")
+}
+
+type EndpointParam struct {
+	// 除 APIUrl 外的其他分流接口地址，按照优先级排序
+	URLs   []string
+	Policy EndpointPolicy
+	// 连续失败多少次后暂时摘除该地址，默认 3 次；只有网络错误、超时、429 和 5xx 计为失败
+	FailureThreshold int
+	// 摘除时长，之后放行一个探测请求，成功后恢复，失败后继续摘除，默认 30s
+	// 有健康的地址时，探测请求在其他请求成功后于后台发送，不影响正常请求
+	EjectionMilliSeconds int
+}
+
+// 对冲请求参数：请求超过 DelayMilliSeconds 仍未返回时，向另一个地址发送相同的请求，使用先成功返回的结果
+// 对冲只发往本次调用中未尝试过的其他地址，只配置了 APIUrl 时不会对冲
+type HedgingParam struct {
+	Enable bool
+	// 发出对冲请求前的等待时间，为 0 时使用最近成功请求耗时的 p95，样本不足时不对冲
+	DelayMilliSeconds int
+	// 对冲请求占全部请求的最大百分比，范围 [1, 100]，默认 5
+	MaxPercent int
+}
+
+type HTTPClientParam struct {
+	// 自定义 HTTP 客户端，请求超时时间仍然由 SDK 设置
+	Client *http.Client
+	// 自定义 Transport，Client 不为空时不生效
+	Transport http.RoundTripper
+	// 每个请求都会携带的 Header
+	Headers map[string]string
+	// 每次请求前调用，返回的 Header 会覆盖 Headers 中的同名 Header，用于携带会轮换的鉴权 token
+	// 返回错误时不发送请求
+	HeaderProvider func() (map[string]string, error)
+	// 请求签名，在设置完所有 Header 后调用，每次重试都会重新签名
+	Signer RequestSigner
+}
+
+// RequestSigner 对发送到分流接口的请求签名，body 为实际发送的请求体，开启请求压缩时为压缩后的内容
+// 返回错误时不发送请求
+type RequestSigner interface {
+	Sign(req *http.Request, body []byte) error
+}
+
+type CompressionParam struct {
+	// 请求体达到 RequestGzipMinBytes 时使用 gzip 压缩，并设置 Content-Encoding: gzip
+	EnableRequestGzip bool
+	// 压缩请求体的最小字节数，默认 1024
+	RequestGzipMinBytes int
+	// 设置 Accept-Encoding: gzip，由 SDK 解压响应体并统计压缩率
+	EnableResponseGzip bool
+}
+
+type ResponseParam struct {
+	// 响应体（解压后）的最大字节数，默认 10 MiB，超过时请求失败
+	MaxBytes int
+	// 不校验 Content-Type；默认只接受 JSON 类型，没有 Content-Type 时不校验
+	SkipContentTypeCheck bool
+}
+
+// 网络请求的重试参数，只有网络错误、429 和 5xx 响应会重试
+// 包括重试在内的总耗时不超过请求的超时时间，剩余时间不足以等待重试间隔时不再重试
+type RetryParam struct {
+	// 最大重试次数
+	MaxRetries int
+	// 重试间隔，每次重试后翻倍，最小 100ms，最大 5s
+	BackoffMilliSeconds int
+}
+
+// 录制回放模式
+type CassetteMode int
+
+const (
+	// 不录制也不回放
+	CassetteModeOff CassetteMode = iota
+	// 将请求参数和原始响应追加写入录制文件
+	CassetteModeRecord
+	// 从录制文件返回响应，不发送网络请求
+	CassetteModeReplay
+)
+
+// 回放时找不到录制记录的处理方式
+type CassetteMissingBehavior int
+
+const (
+	// 返回错误
+	CassetteMissingFail CassetteMissingBehavior = iota
+	// 返回没有任何试验的成功响应，调用方得到默认值
+	CassetteMissingDefault
+)
+
+type CassetteParam struct {
+	Mode CassetteMode
+	// 录制文件路径，每行一条 JSON 记录
+	Path            string
+	MissingBehavior CassetteMissingBehavior
 }
@@ -0,0 +1,222 @@
+package beans
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// DumpFormat 序列化结果的编码格式
+type DumpFormat int
+
+const (
+	// DumpFormatJSON 原始 JSON 格式，与旧版本 Dump() 输出一致
+	DumpFormatJSON DumpFormat = iota
+	// DumpFormatBase64 带版本信封的 base64url 编码，不压缩
+	DumpFormatBase64
+	// DumpFormatGzip 带版本信封的 gzip 压缩 + base64url 编码，适合放在 Header、Cookie 和 URL 中
+	DumpFormatGzip
+)
+
+func (format DumpFormat) String() string {
+	switch format {
+	case DumpFormatJSON:
+		return "json"
+	case DumpFormatBase64:
+		return "base64"
+	case DumpFormatGzip:
+		return "gzip"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	// 信封版本号
+	dumpEnvelopeVersion = "v1"
+	// 信封各段的分隔符，不在 base64url 字符集中
+	dumpEnvelopeSeparator = "."
+
+	dumpCodecRaw  = "raw"
+	dumpCodecGzip = "gz"
+
+	// 解压后的最大字节数，Dump 结果可能来自不可信的 Header 和 Cookie，避免 gzip 炸弹耗尽内存
+	maxDumpDecodedBytes = 10 << 20
+)
+
+// EncodeDumpData 按照指定格式编码 DumpData
+// 信封格式为 <版本>.<编码>.<base64url 数据>，例如 v1.gz.H4sIAAAA...
+func EncodeDumpData(data DumpData, format DumpFormat) (string, error) {
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	switch format {
+	case DumpFormatJSON:
+		return string(jsonBytes), nil
+	case DumpFormatBase64:
+		return buildDumpEnvelope(dumpCodecRaw, jsonBytes), nil
+	case DumpFormatGzip:
+		var buffer bytes.Buffer
+		writer, err := gzip.NewWriterLevel(&buffer, gzip.BestCompression)
+		if err != nil {
+			return "", err
+		}
+		if _, err = writer.Write(jsonBytes); err != nil {
+			return "", err
+		}
+		if err = writer.Close(); err != nil {
+			return "", err
+		}
+		return buildDumpEnvelope(dumpCodecGzip, buffer.Bytes()), nil
+	default:
+		return "", errors.New("unsupported dump format")
+	}
+}
+
+// DecodeDumpData 解析 Dump 结果，自动识别原始 JSON 和带版本信封的格式
+func DecodeDumpData(dump string) (DumpData, error) {
+	var data DumpData
+	dump = strings.TrimSpace(dump)
+	if dump == "" {
+		return data, errors.New("invalid serialized data: empty dump")
+	}
+
+	// 旧版本的原始 JSON 格式
+	if strings.HasPrefix(dump, "{") {
+		err := json.Unmarshal([]byte(dump), &data)
+		return data, err
+	}
+
+	jsonBytes, err := decodeDumpEnvelope(dump)
+	if err != nil {
+		return data, err
+	}
+	err = json.Unmarshal(jsonBytes, &data)
+	return data, err
+}
+
+// DetectDumpFormat 识别 Dump 结果的编码格式，不校验数据内容
+func DetectDumpFormat(dump string) (DumpFormat, error) {
+	dump = strings.TrimSpace(dump)
+	if strings.HasPrefix(dump, "{") {
+		return DumpFormatJSON, nil
+	}
+	parts := strings.SplitN(dump, dumpEnvelopeSeparator, 3)
+	if len(parts) == 3 && parts[0] == dumpEnvelopeVersion {
+		switch parts[1] {
+		case dumpCodecRaw:
+			return DumpFormatBase64, nil
+		case dumpCodecGzip:
+			return DumpFormatGzip, nil
+		}
+	}
+	return DumpFormatJSON, errors.New("invalid serialized data: unknown dump format")
+}
+
+func buildDumpEnvelope(codec string, payload []byte) string {
+	return dumpEnvelopeVersion + dumpEnvelopeSeparator + codec + dumpEnvelopeSeparator + base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func decodeDumpEnvelope(dump string) ([]byte, error) {
+	parts := strings.SplitN(dump, dumpEnvelopeSeparator, 3)
+	if len(parts) != 3 {
+		return nil, errors.New("invalid serialized data: unknown dump format")
+	}
+	if parts[0] != dumpEnvelopeVersion {
+		return nil, errors.New("invalid serialized data: unsupported dump version " + parts[0])
+	}
+
+	// 兼容带 padding 的 base64url 数据
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[2], "="))
+	if err != nil {
+		return nil, errors.New("invalid serialized data: " + err.Error())
+	}
+
+	switch parts[1] {
+	case dumpCodecRaw:
+		return payload, nil
+	case dumpCodecGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, errors.New("invalid serialized data: " + err.Error())
+		}
+		defer reader.Close()
+		data, err := ioutil.ReadAll(io.LimitReader(reader, maxDumpDecodedBytes+1))
+		if err != nil {
+			return nil, errors.New("invalid serialized data: " + err.Error())
+		}
+		if len(data) > maxDumpDecodedBytes {
+			return nil, fmt.Errorf("invalid serialized data: decoded dump exceeds %d bytes", maxDumpDecodedBytes)
+		}
+		return data, nil
+	default:
+		return nil, errors.New("invalid serialized data: unsupported dump codec " + parts[1])
+	}
+}
+
+// 裁剪原始响应体，results 和 out_list 中只保留定义了指定参数的试验，其它字段原样保留
+func trimResponseBody(responseBody string, paramNames []string) (string, error) {
+	if responseBody == "" {
+		return "", nil
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(responseBody), &body); err != nil {
+		return "", err
+	}
+
+	names := make(map[string]bool, len(paramNames))
+	for _, name := range paramNames {
+		names[name] = true
+	}
+
+	for _, key := range []string{"results", "out_list"} {
+		raw, ok := body[key]
+		if !ok {
+			continue
+		}
+		trimmed, err := filterRawExperiments(raw, names)
+		if err != nil {
+			return "", err
+		}
+		body[key] = trimmed
+	}
+
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	return string(bodyBytes), nil
+}
+
+// 筛选定义了指定参数的试验，保留试验的原始 JSON 以免丢失 trigger_content_ext 等扩展字段
+func filterRawExperiments(raw json.RawMessage, names map[string]bool) (json.RawMessage, error) {
+	var experiments []json.RawMessage
+	if err := json.Unmarshal(raw, &experiments); err != nil {
+		return nil, err
+	}
+
+	filtered := make([]json.RawMessage, 0, len(experiments))
+	for _, experiment := range experiments {
+		var variables struct {
+			VariableList []Variables `json:"variables"`
+		}
+		if err := json.Unmarshal(experiment, &variables); err != nil {
+			return nil, err
+		}
+		for _, variable := range variables.VariableList {
+			if names[variable.Name] {
+				filtered = append(filtered, experiment)
+				break
+			}
+		}
+	}
+	return json.Marshal(filtered)
+}
@@ -0,0 +1,126 @@
+package beans
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecodeDumpData(t *testing.T) {
+	data := DumpData{
+		DistinctId:   "user",
+		IsLoginId:    true,
+		CustomIDs:    map[string]string{"device": "d1"},
+		ResponseBody: `{"status":"SUCCESS","results":[]}`,
+		Timestamp:    1700000000000,
+	}
+	for _, format := range []DumpFormat{DumpFormatJSON, DumpFormatBase64, DumpFormatGzip} {
+		dump, err := EncodeDumpData(data, format)
+		if err != nil {
+			t.Fatalf("%v: encode failed: %v", format, err)
+		}
+		detected, err := DetectDumpFormat(dump)
+		if err != nil || detected != format {
+			t.Fatalf("%v: detected %v, %v", format, detected, err)
+		}
+		decoded, err := DecodeDumpData(dump)
+		if err != nil {
+			t.Fatalf("%v: decode failed: %v", format, err)
+		}
+		if decoded.DistinctId != data.DistinctId || decoded.ResponseBody != data.ResponseBody || decoded.CustomIDs["device"] != "d1" {
+			t.Fatalf("%v: decoded %+v", format, decoded)
+		}
+	}
+}
+
+func TestDecodeDumpDataRejectsGzipBomb(t *testing.T) {
+	var buffer bytes.Buffer
+	writer, _ := gzip.NewWriterLevel(&buffer, gzip.BestCompression)
+	chunk := make([]byte, 1<<20)
+	for i := 0; i < maxDumpDecodedBytes/len(chunk)+1; i++ {
+		_, _ = writer.Write(chunk)
+	}
+	_ = writer.Close()
+
+	_, err := DecodeDumpData(buildDumpEnvelope(dumpCodecGzip, buffer.Bytes()))
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Fatalf("expected size limit error, got %v", err)
+	}
+}
+
+func TestTrimResponseBody(t *testing.T) {
+	body := `{"status":"SUCCESS","track_config":{"trigger_switch":true,"trigger_content_ext":["group_name"]},` +
+		`"results":[` +
+		`{"abtest_experiment_id":"1","group_name":"g1","variables":[{"name":"color","value":"red","type":"STRING"}]},` +
+		`{"abtest_experiment_id":"2","variables":[{"name":"size","value":"1","type":"INTEGER"},{"name":"shape","value":"round","type":"STRING"}]}],` +
+		`"out_list":[{"abtest_experiment_id":"3","variables":[{"name":"shape","value":"square","type":"STRING"}]}]}`
+	tests := []struct {
+		name        string
+		paramNames  []string
+		results     []string
+		outList     []string
+		experiments string
+	}{
+		{name: "single param", paramNames: []string{"color"}, results: []string{"1"}},
+		// 一个试验定义了多个参数时，保留整个试验
+		{name: "param of multi-param experiment", paramNames: []string{"size"}, results: []string{"2"}},
+		{name: "results and out_list", paramNames: []string{"shape"}, results: []string{"2"}, outList: []string{"3"}},
+		// 未知的参数名不报错，不保留任何试验
+		{name: "unknown param", paramNames: []string{"missing"}},
+		{name: "no params", paramNames: nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trimmed, err := trimResponseBody(body, test.paramNames)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var response struct {
+				Status      string          `json:"status"`
+				TrackConfig json.RawMessage `json:"track_config"`
+				Results     []RawExperiment `json:"results"`
+				OutList     []RawExperiment `json:"out_list"`
+			}
+			if err = json.Unmarshal([]byte(trimmed), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Status != "SUCCESS" || string(response.TrackConfig) != `{"trigger_switch":true,"trigger_content_ext":["group_name"]}` {
+				t.Fatalf("status and track_config should be kept: %s", trimmed)
+			}
+			if ids := rawExperimentIds(response.Results); !reflect.DeepEqual(ids, test.results) {
+				t.Fatalf("results = %v, want %v", ids, test.results)
+			}
+			if ids := rawExperimentIds(response.OutList); !reflect.DeepEqual(ids, test.outList) {
+				t.Fatalf("out_list = %v, want %v", ids, test.outList)
+			}
+			// 保留试验的原始字段，供 trigger_content_ext 使用
+			for _, experiment := range response.Results {
+				if experiment.AbtestExperimentId == "1" && string(experiment.Fields["group_name"]) != `"g1"` {
+					t.Fatalf("ext field is lost: %s", trimmed)
+				}
+			}
+		})
+	}
+}
+
+func rawExperimentIds(experiments []RawExperiment) []string {
+	var ids []string
+	for _, experiment := range experiments {
+		ids = append(ids, experiment.AbtestExperimentId)
+	}
+	return ids
+}
+
+func TestTrimResponseBodyRejectsInvalidBody(t *testing.T) {
+	for _, body := range []string{`not json`, `{"results":{}}`, `{"results":[{"variables":"x"}]}`} {
+		if _, err := trimResponseBody(body, []string{"color"}); err == nil {
+			t.Errorf("expected error for %s", body)
+		}
+	}
+	if trimmed, err := trimResponseBody("", []string{"color"}); err != nil || trimmed != "" {
+		t.Fatalf("empty body: %q, %v", trimmed, err)
+	}
+}
@@ -1,8 +1,6 @@
 package beans
 
-import (
-	"encoding/json"
-)
+import "sort"
 
 type Experiment struct {
 	// distinct_id 标识
@@ -140,6 +138,21 @@ func (result *AllExperimentsResult) Timestamp() int64 {
 	return result.timestamp
 }
 
+// ResponseBody returns the raw response body.
+func (result *AllExperimentsResult) ResponseBody() string {
+	return result.responseBody
+}
+
+// ParamNames returns the sorted names of all params with a result.
+func (result *AllExperimentsResult) ParamNames() []string {
+	names := make([]string, 0, len(result.experiments))
+	for name := range result.experiments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (result *AllExperimentsResult) SetTrackCallback(callback func(paramName string, experiment InnerExperiment)) {
 	result.trackCallback = callback
 }
@@ -196,6 +209,12 @@ type DumpData struct {
 // Dump 序列化完整的上下文信息（包括 distinct_id、is_login_id、custom_ids 和响应体）
 // 返回 JSON 字符串，用于跨服务传递
 func (result *AllExperimentsResult) Dump() (string, error) {
+	return result.DumpWithFormat(DumpFormatJSON)
+}
+
+// DumpWithFormat 按照指定格式序列化完整的上下文信息
+// DumpFormatGzip 输出压缩后的 base64url 字符串，可直接放在 Header、Cookie 或 URL 中
+func (result *AllExperimentsResult) DumpWithFormat(format DumpFormat) (string, error) {
 	data := DumpData{
 		DistinctId:   result.distinctId,
 		IsLoginId:    result.isLoginId,
@@ -204,12 +223,30 @@ func (result *AllExperimentsResult) Dump() (string, error) {
 		Timestamp:    result.timestamp,
 	}
 
-	jsonBytes, err := json.Marshal(data)
+	return EncodeDumpData(data, format)
+}
+
+// DumpParams 只序列化定义了指定参数的试验（包括 results 和 out_list），用于下游只需要少量参数的场景
+// 裁剪后的响应体保留 track_config，下游服务加载后仍能正确埋点
+func (result *AllExperimentsResult) DumpParams(paramNames ...string) (string, error) {
+	return result.DumpParamsWithFormat(DumpFormatJSON, paramNames...)
+}
+
+// DumpParamsWithFormat 按照指定格式序列化定义了指定参数的试验
+func (result *AllExperimentsResult) DumpParamsWithFormat(format DumpFormat, paramNames ...string) (string, error) {
+	responseBody, err := trimResponseBody(result.responseBody, paramNames)
 	if err != nil {
 		return "", err
 	}
+	data := DumpData{
+		DistinctId:   result.distinctId,
+		IsLoginId:    result.isLoginId,
+		CustomIDs:    result.customIDs,
+		ResponseBody: responseBody,
+		Timestamp:    result.timestamp,
+	}
 
-	return string(jsonBytes), nil
+	return EncodeDumpData(data, format)
 }
 
 // AllExperimentsResultBuilder is used to construct an AllExperimentsResult object.
@@ -0,0 +1,265 @@
+package beans
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// InnerExperiment 声明的 JSON 字段名，按照字段声明顺序从 struct tag 生成
+// 与 encoding/json 一致，没有 json tag 的字段使用字段名，缓存导出时 json.Marshal 使用 Result 和 TrackExtValue 作为 key
+var experimentFieldNames = jsonFieldNames(reflect.TypeOf(InnerExperiment{}))
+
+func jsonFieldNames(structType reflect.Type) []string {
+	names := make([]string, 0, structType.NumField())
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+/*
+UnmarshalJSON 只解析一次试验，声明的字段直接赋值，不保留其他字段
+新增带 json tag 的字段时需要同时在 fieldTarget 中声明
+*/
+func (experiment *InnerExperiment) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	return experiment.assignFields(data, fields)
+}
+
+/*
+将字段按照声明顺序赋值给声明的字段
+与 encoding/json 的 struct tag 解析一致，字段名不区分大小写；同时存在大小写不同的同名字段时优先使用大小写完全一致的字段，
+否则使用 data 中第一个出现的字段，结果不受 map 遍历顺序影响
+*/
+func (experiment *InnerExperiment) assignFields(data []byte, fields map[string]json.RawMessage) error {
+	// 大小写与声明不同的字段，key 为声明的字段名，大部分响应中不存在
+	var folded map[string][]string
+	for key := range fields {
+		if target, stringTarget := experiment.fieldTarget(key); target != nil || stringTarget != nil {
+			continue
+		}
+		name := foldExperimentField(key)
+		if name == "" {
+			continue
+		}
+		if _, exact := fields[name]; exact {
+			continue
+		}
+		if folded == nil {
+			folded = make(map[string][]string)
+		}
+		folded[name] = append(folded[name], key)
+	}
+
+	for _, name := range experimentFieldNames {
+		key := name
+		raw, ok := fields[name]
+		if !ok {
+			candidates := folded[name]
+			if len(candidates) == 0 {
+				continue
+			}
+			key = firstObjectKey(data, candidates)
+			raw = fields[key]
+		}
+		target, stringTarget := experiment.fieldTarget(name)
+		if stringTarget != nil {
+			// 服务端可能返回数字或布尔值，例如数字类型的试验版本，转为字符串
+			value, ok := scalarString(raw)
+			if !ok {
+				return fmt.Errorf("invalid field %s of experiment: expected string, got %s", key, jsonKind(raw))
+			}
+			*stringTarget = value
+		}
+		if target != nil {
+			if err := json.Unmarshal(raw, target); err != nil {
+				return fmt.Errorf("invalid field %s of experiment: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// 返回 candidates 中在 JSON 对象 data 里第一个出现的 key，只有一个候选时不扫描 data
+func firstObjectKey(data []byte, candidates []string) string {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if _, err := decoder.Token(); err == nil {
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				break
+			}
+			if key, ok := token.(string); ok {
+				for _, candidate := range candidates {
+					if key == candidate {
+						return key
+					}
+				}
+			}
+			var value json.RawMessage
+			if err = decoder.Decode(&value); err != nil {
+				break
+			}
+		}
+	}
+	// data 已经被成功解析过，不会走到这里
+	sort.Strings(candidates)
+	return candidates[0]
+}
+
+// 返回字段名对应的字段，字符串字段通过 stringTarget 返回，未声明的字段都返回 nil
+func (experiment *InnerExperiment) fieldTarget(name string) (target interface{}, stringTarget *string) {
+	switch name {
+	case "abtest_experiment_id":
+		stringTarget = &experiment.AbtestExperimentId
+	case "abtest_experiment_group_id":
+		stringTarget = &experiment.AbtestExperimentGroupId
+	case "abtest_experiment_result_id":
+		stringTarget = &experiment.AbtestExperimentResultId
+	case "experiment_type":
+		stringTarget = &experiment.ExperimentType
+	case "subject_name":
+		stringTarget = &experiment.SubjectName
+	case "subject_id":
+		stringTarget = &experiment.SubjectId
+	case "abtest_experiment_version":
+		stringTarget = &experiment.AbtestExperimentVersion
+	case "stickiness":
+		stringTarget = &experiment.Stickiness
+	case "cacheable":
+		target = &experiment.Cacheable
+	case "is_control_group":
+		target = &experiment.IsControlGroup
+	case "is_white_list":
+		target = &experiment.IsWhiteList
+	case "variables":
+		target = &experiment.VariableList
+	case "Result":
+		target = &experiment.Result
+	case "TrackExtValue":
+		target = &experiment.TrackExtValue
+	}
+	return target, stringTarget
+}
+
+// 返回与 key 大小写不同的声明字段名，没有时返回空字符串
+func foldExperimentField(key string) string {
+	for _, name := range experimentFieldNames {
+		if strings.EqualFold(key, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+/*
+RawExperiment 是解析分流响应时使用的试验，在 InnerExperiment 之外保留原始字段，供 ApplyTrackContentExt 读取 track_config 中的 ext 字段
+原始字段只在解析响应期间存在，ApplyTrackContentExt 之后释放，返回给调用方的 InnerExperiment 不保留原始字段
+*/
+type RawExperiment struct {
+	InnerExperiment
+	Fields map[string]json.RawMessage `json:"-"`
+	// 试验不是对象或者字段类型错误时记录原因，不影响同一响应中的其他试验
+	InvalidReason string `json:"-"`
+}
+
+func (experiment *RawExperiment) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		experiment.InvalidReason = "experiment must be an object, got " + jsonKind(data)
+		return nil
+	}
+	if err := experiment.InnerExperiment.assignFields(data, fields); err != nil {
+		experiment.InvalidReason = err.Error()
+		return nil
+	}
+	// ext 字段可能是声明的字段，例如 abtest_experiment_result_id，所以保留全部原始值
+	delete(fields, "variables")
+	experiment.Fields = fields
+	return nil
+}
+
+/*
+ApplyTrackContentExt 将 track_config.trigger_content_ext 中的字段以 "$" + 字段名写入 TrackExtValue，之后释放保留的原始字段
+ext 字段名区分大小写，数字和布尔值转为字符串，null、对象和数组跳过
+*/
+func (experiment *RawExperiment) ApplyTrackContentExt(names []string) InnerExperiment {
+	fields := experiment.Fields
+	experiment.Fields = nil
+	for _, name := range names {
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+		value, ok := scalarString(raw)
+		if !ok || jsonKind(raw) == "null" {
+			continue
+		}
+		if experiment.TrackExtValue == nil {
+			experiment.TrackExtValue = make(map[string]interface{}, len(names))
+		}
+		experiment.TrackExtValue["$"+name] = value
+	}
+	return experiment.InnerExperiment
+}
+
+// 将 JSON 字符串、数字或布尔值转为字符串，数字保留原始写法；null 返回空字符串，对象和数组返回 false
+func scalarString(raw json.RawMessage) (string, bool) {
+	switch jsonKind(raw) {
+	case "string":
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return "", false
+		}
+		return value, true
+	case "number", "boolean":
+		return string(bytes.TrimSpace(raw)), true
+	case "null":
+		return "", true
+	default:
+		return "", false
+	}
+}
+
+// 根据第一个非空白字符判断 JSON 值的类型
+func jsonKind(raw json.RawMessage) string {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 {
+		return "empty"
+	}
+	switch trimmed[0] {
+	case '"':
+		return "string"
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	default:
+		return "number"
+	}
+}
@@ -0,0 +1,66 @@
+package beans
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestExperimentFieldNamesFollowTags(t *testing.T) {
+	want := []string{
+		"abtest_experiment_id", "abtest_experiment_group_id", "abtest_experiment_result_id", "experiment_type",
+		"subject_name", "subject_id", "abtest_experiment_version", "stickiness",
+		"cacheable", "is_control_group", "is_white_list", "variables", "Result", "TrackExtValue",
+	}
+	if !reflect.DeepEqual(experimentFieldNames, want) {
+		t.Fatalf("experimentFieldNames = %v", experimentFieldNames)
+	}
+	// 新增的字段需要在 fieldTarget 中声明，否则解析时会被忽略
+	var experiment InnerExperiment
+	for _, name := range experimentFieldNames {
+		if target, stringTarget := experiment.fieldTarget(name); target == nil && stringTarget == nil {
+			t.Errorf("field %s has no target", name)
+		}
+	}
+}
+
+func TestInnerExperimentCaseVariantsResolveInDocumentOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "first variant", data: `{"ABTEST_EXPERIMENT_ID":"a","Abtest_Experiment_Id":"b","abtest_EXPERIMENT_id":"c"}`, want: "a"},
+		{name: "reordered variants", data: `{"abtest_EXPERIMENT_id":"c","Abtest_Experiment_Id":"b","ABTEST_EXPERIMENT_ID":"a"}`, want: "c"},
+		{name: "exact match wins", data: `{"ABTEST_EXPERIMENT_ID":"a","abtest_experiment_id":"exact","Abtest_Experiment_Id":"b"}`, want: "exact"},
+		{name: "single variant", data: `{"Abtest_Experiment_Id":"b"}`, want: "b"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// map 遍历顺序随机，多次解析结果一致
+			for i := 0; i < 50; i++ {
+				var experiment InnerExperiment
+				if err := json.Unmarshal([]byte(test.data), &experiment); err != nil {
+					t.Fatal(err)
+				}
+				if experiment.AbtestExperimentId != test.want {
+					t.Fatalf("attempt %d: AbtestExperimentId = %q, want %q", i, experiment.AbtestExperimentId, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestInnerExperimentInvalidFieldIsDeterministic(t *testing.T) {
+	data := []byte(`{"is_white_list":"yes","ABTEST_EXPERIMENT_ID":{},"Abtest_Experiment_Id":"b"}`)
+	for i := 0; i < 50; i++ {
+		var experiment RawExperiment
+		if err := json.Unmarshal(data, &experiment); err != nil {
+			t.Fatal(err)
+		}
+		// 按照字段声明顺序校验，先报告 abtest_experiment_id
+		if want := "invalid field ABTEST_EXPERIMENT_ID of experiment: expected string, got object"; experiment.InvalidReason != want {
+			t.Fatalf("attempt %d: InvalidReason = %q", i, experiment.InvalidReason)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package beans
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileConfig 是配置文件和 SENSORS_AB_* 环境变量中的 SDK 配置，未设置的字段使用默认值
+type FileConfig struct {
+	// API 地址
+	APIUrl string `json:"api_url" yaml:"api_url"`
+
+	// 除 api_url 外的其他分流接口地址和选择策略（failover、round_robin、lowest_latency）
+	Endpoints                []string `json:"endpoints" yaml:"endpoints"`
+	EndpointPolicy           string   `json:"endpoint_policy" yaml:"endpoint_policy"`
+	EndpointFailureThreshold int      `json:"endpoint_failure_threshold" yaml:"endpoint_failure_threshold"`
+	EndpointEjection         Duration `json:"endpoint_ejection" yaml:"endpoint_ejection"`
+
+	// 对冲请求，hedging_delay 为 0 时使用最近请求耗时的 p95
+	Hedging           bool     `json:"hedging" yaml:"hedging"`
+	HedgingDelay      Duration `json:"hedging_delay" yaml:"hedging_delay"`
+	HedgingMaxPercent int      `json:"hedging_max_percent" yaml:"hedging_max_percent"`
+
+	// 试验缓存用户量和缓存时间
+	ExperimentCacheSize int      `json:"experiment_cache_size" yaml:"experiment_cache_size"`
+	ExperimentCacheTTL  Duration `json:"experiment_cache_ttl" yaml:"experiment_cache_ttl"`
+
+	// $ABTestTrigger 事件缓存数量和缓存时间
+	EventCacheSize int      `json:"event_cache_size" yaml:"event_cache_size"`
+	EventCacheTTL  Duration `json:"event_cache_ttl" yaml:"event_cache_ttl"`
+
+	// 开启 A/B 事件缓存
+	EnableEventCache bool `json:"enable_event_cache" yaml:"enable_event_cache"`
+
+	// 开启请求耗时记录
+	EnableRecordRequestCostTime bool `json:"enable_record_request_cost_time" yaml:"enable_record_request_cost_time"`
+
+	// 默认的网络请求超时时间
+	RequestTimeout Duration `json:"request_timeout" yaml:"request_timeout"`
+
+	// 网络请求失败后的最大重试次数和首次重试间隔
+	MaxRetries   int      `json:"max_retries" yaml:"max_retries"`
+	RetryBackoff Duration `json:"retry_backoff" yaml:"retry_backoff"`
+
+	// 请求体和响应体的 gzip 压缩
+	RequestGzip         bool `json:"request_gzip" yaml:"request_gzip"`
+	RequestGzipMinBytes int  `json:"request_gzip_min_bytes" yaml:"request_gzip_min_bytes"`
+	ResponseGzip        bool `json:"response_gzip" yaml:"response_gzip"`
+
+	// 响应体的最大字节数
+	MaxResponseBytes int `json:"max_response_bytes" yaml:"max_response_bytes"`
+
+	// HTTP 连接参数
+	HTTPTransport FileTransportConfig `json:"http_transport" yaml:"http_transport"`
+}
+
+// FileTransportConfig 是配置文件中的 HTTP 连接参数
+// 跳过证书校验只用于测试，不支持通过配置文件开启
+type FileTransportConfig struct {
+	MaxIdleConnsPerHost int      `json:"max_idle_conns_per_host" yaml:"max_idle_conns_per_host"`
+	MaxIdleConns        int      `json:"max_idle_conns" yaml:"max_idle_conns"`
+	MaxConnsPerHost     int      `json:"max_conns_per_host" yaml:"max_conns_per_host"`
+	IdleConnTimeout     Duration `json:"idle_conn_timeout" yaml:"idle_conn_timeout"`
+	DialTimeout         Duration `json:"dial_timeout" yaml:"dial_timeout"`
+	DialKeepAlive       Duration `json:"dial_keep_alive" yaml:"dial_keep_alive"`
+	CAFile              string   `json:"ca_file" yaml:"ca_file"`
+	CertFile            string   `json:"cert_file" yaml:"cert_file"`
+	KeyFile             string   `json:"key_file" yaml:"key_file"`
+	ProxyURL            string   `json:"proxy_url" yaml:"proxy_url"`
+}
+
+// Duration 支持 "30s"、"10m" 格式的字符串，数字按毫秒处理
+type Duration time.Duration
+
+// ParseDuration 解析 "30s"、"10m" 格式的字符串，纯数字按毫秒处理
+func ParseDuration(value string) (Duration, error) {
+	duration, err := time.ParseDuration(value)
+	if err == nil {
+		return Duration(duration), nil
+	}
+	var milliseconds int64
+	if jsonErr := json.Unmarshal([]byte(value), &milliseconds); jsonErr == nil {
+		return Duration(time.Duration(milliseconds) * time.Millisecond), nil
+	}
+	return 0, errors.New("invalid duration " + strconv.Quote(value) + ", expected a value like 30s or milliseconds")
+}
+
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		value = string(data)
+	}
+	duration, err := ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = duration
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	duration, err := ParseDuration(node.Value)
+	if err != nil {
+		return err
+	}
+	*d = duration
+	return nil
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
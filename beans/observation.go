@@ -0,0 +1,44 @@
+package beans
+
+import "time"
+
+// RequestObservation 记录一次发送到分流接口的网络请求，回放录制文件时不会产生
+type RequestObservation struct {
+	URL        string
+	StatusCode int
+	Duration   time.Duration
+	// 序列化后的请求体大小和实际发送的请求体大小，开启请求压缩并达到阈值时后者为压缩后的大小
+	RequestBytes     int
+	RequestWireBytes int
+	// 解压后的响应体大小和实际接收的响应体大小，后者为 0 表示未知，例如由 Transport 自动解压
+	ResponseBytes     int
+	ResponseWireBytes int
+	// 解析或校验失败被丢弃的试验
+	InvalidExperiments []InvalidExperiment
+	// 请求失败时的错误
+	Err error
+}
+
+// InvalidExperiment 记录响应中校验失败被丢弃的试验
+type InvalidExperiment struct {
+	// 所在的列表，results 或 out_list
+	List       string
+	Experiment InnerExperiment
+	Reason     string
+}
+
+// RequestCompressionRatio 返回请求体压缩后与压缩前的大小之比，未压缩时为 1
+func (observation RequestObservation) RequestCompressionRatio() float64 {
+	if observation.RequestBytes == 0 || observation.RequestWireBytes == 0 {
+		return 1
+	}
+	return float64(observation.RequestWireBytes) / float64(observation.RequestBytes)
+}
+
+// ResponseCompressionRatio 返回响应体压缩后与解压后的大小之比，未压缩或大小未知时为 1
+func (observation RequestObservation) ResponseCompressionRatio() float64 {
+	if observation.ResponseBytes == 0 || observation.ResponseWireBytes == 0 {
+		return 1
+	}
+	return float64(observation.ResponseWireBytes) / float64(observation.ResponseBytes)
+}
@@ -1,5 +1,7 @@
 package beans
 
+import "time"
+
 type RequestParam struct {
 	// 试验变量名
 	ParamName string
@@ -42,4 +44,114 @@ type LoadDumpedParam struct {
 
 	// 是否自动采集 A/B Testing 埋点事件
 	EnableAutoTrackABEvent bool
+
+	// 序列化数据的最大有效时长，超过后返回 DumpExpiredError，为 0 时不校验
+	// 旧版本 SDK 生成的序列化数据没有时间戳，设置 MaxAge 后总是视为过期
+	MaxAge time.Duration
+
+	// 校验 MaxAge 时允许的服务间时钟偏差
+	ClockSkewTolerance time.Duration
+
+	// 序列化数据过期时是否从网络重新拉取，而不是返回错误
+	RefreshOnExpired bool
+
+	// 重新拉取时的 HTTP 请求参数
+	Properties map[string]interface{}
+
+	// 重新拉取时的网络请求超时时间，单位 ms，默认 3s
+	TimeoutMilliseconds int
+}
+
+// UserRef 批量请求中的一个用户
+type UserRef struct {
+	// 用户标识
+	DistinctId string
+
+	// 是否为登录 ID
+	IsLoginId bool
+
+	// 自定义分流主体
+	CustomIDs map[string]string
+
+	// HTTP 请求参数
+	Properties map[string]interface{}
+}
+
+// BatchFetchOptions 是 FetchAllExperimentsBatch 接口的请求参数
+type BatchFetchOptions struct {
+	// 并发请求数，默认 8
+	Concurrency int
+
+	// 每秒最多发送的网络请求数，为 0 时不限速
+	RequestsPerSecond float64
+
+	// 网络请求超时时间，单位 ms，默认 3s
+	TimeoutMilliseconds int
+
+	// 是否自动采集 A/B Testing 埋点事件，离线任务通常需要关闭
+	EnableAutoTrackABEvent bool
+
+	// 是否优先使用试验缓存，并把网络请求的结果写入缓存
+	// 缓存中只保存可缓存的试验，命中缓存的结果中不包含 out_list
+	UseCache bool
+}
+
+// BatchFetchResult 批量请求中一个用户的结果
+type BatchFetchResult struct {
+	// 用户在请求列表中的下标
+	Index int
+
+	User UserRef
+
+	Result AllExperimentsResult
+
+	Err error
+
+	// 是否来自缓存
+	FromCache bool
+}
+
+// PrefetchOptions 是 Prefetch 接口的请求参数
+type PrefetchOptions struct {
+	// 并发请求数，默认 8
+	Concurrency int
+
+	// 每秒最多发送的网络请求数，为 0 时不限速
+	RequestsPerSecond float64
+
+	// 网络请求超时时间，单位 ms，默认 3s
+	TimeoutMilliseconds int
+
+	// 每个用户预热结束后的回调，会被并发调用
+	OnProgress func(progress PrefetchProgress)
+}
+
+// PrefetchProgress 一个用户的预热结果
+type PrefetchProgress struct {
+	User UserRef
+
+	Err error
+
+	// 缓存中已经包含需要的试验参数，没有发送网络请求
+	Skipped bool
+
+	// 已经结束的用户数
+	Done int
+
+	// 需要预热的用户总数
+	Total int
+}
+
+// PrefetchSummary 预热的最终结果
+type PrefetchSummary struct {
+	Total     int
+	Succeeded int
+	Skipped   int
+	Failed    int
+
+	// 预热失败的用户及原因
+	Failures []PrefetchProgress
+
+	// ctx 结束时的错误，此时部分用户没有预热
+	Err error
 }
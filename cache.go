@@ -0,0 +1,119 @@
+package sensorsabtest
+
+import (
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+	"github.com/sensorsdata/abtesting-sdk-go/utils"
+	"github.com/sensorsdata/abtesting-sdk-go/utils/lru"
+)
+
+/*
+清除用户的试验缓存，下次 FastFetchABTest 会从网络获取
+*/
+func (sensors *SensorsABTest) InvalidateUser(distinctId string, isLoginId bool, customIDs map[string]string) {
+	idKey := getExperimentUserKey(distinctId, customIDs, isLoginId)
+	experimentLock.Lock()
+	defer experimentLock.Unlock()
+	userExperimentsCache.Remove(idKey)
+	userExperimentTime.Remove(idKey)
+}
+
+/*
+清除试验的缓存，用于试验停止或者重新分流后立即生效
+会移除该试验所有分组的缓存，并从所有用户的试验映射中移除该试验
+*/
+func (sensors *SensorsABTest) InvalidateExperiment(experimentId string) {
+	experimentLock.Lock()
+	defer experimentLock.Unlock()
+	invalidateExperimentCache(experimentId)
+}
+
+// 调用方需要持有 experimentLock
+func invalidateExperimentCache(experimentId string) {
+	experimentCache.RemoveFunc(func(key lru.Key, value interface{}) bool {
+		return value.(beans.InnerExperiment).AbtestExperimentId == experimentId
+	})
+
+	// 先收集需要修改的用户，避免在遍历时修改缓存
+	updatedUsers := make(map[string][]beans.UserExperiment)
+	userExperimentsCache.RemoveFunc(func(key lru.Key, value interface{}) bool {
+		userExperiments := value.([]beans.UserExperiment)
+		remaining := make([]beans.UserExperiment, 0, len(userExperiments))
+		for _, userExperiment := range userExperiments {
+			if userExperiment.AbtestExperimentId != experimentId {
+				remaining = append(remaining, userExperiment)
+			}
+		}
+		if len(remaining) == len(userExperiments) {
+			return false
+		}
+		updatedUsers[key.(string)] = remaining
+		return true
+	})
+	for idKey, remaining := range updatedUsers {
+		if len(remaining) == 0 {
+			userExperimentTime.Remove(idKey)
+			continue
+		}
+		userExperimentsCache.Add(idKey, remaining)
+	}
+}
+
+/*
+清除所有的试验缓存
+*/
+func (sensors *SensorsABTest) PurgeAll() {
+	experimentLock.Lock()
+	defer experimentLock.Unlock()
+	experimentCache.Clear()
+	userExperimentsCache.Clear()
+	userExperimentTime.Clear()
+}
+
+/*
+清除用户的 $ABTestTrigger 去重缓存，下次命中试验时会重新触发事件
+新 SaaS 环境中以分流主体 ID 作为缓存标识，主体 ID 与 distinctId 相同时同样会被清除
+*/
+func (sensors *SensorsABTest) InvalidateUserEvents(distinctId string, customIDs map[string]string) {
+	customIDsKey := utils.MapToJson(customIDs)
+	removeEvents(func(idEvent eventKey, hitExperiment beans.HitExperiment) bool {
+		if idEvent.subjectId != "" {
+			return idEvent.subjectId == distinctId
+		}
+		return idEvent.distinctId == distinctId && idEvent.customIDs == customIDsKey
+	})
+}
+
+/*
+清除试验的 $ABTestTrigger 去重缓存
+*/
+func (sensors *SensorsABTest) InvalidateExperimentEvents(experimentId string) {
+	removeEvents(func(idEvent eventKey, hitExperiment beans.HitExperiment) bool {
+		return hitExperiment.AbtestExperimentId == experimentId
+	})
+}
+
+/*
+清除所有的 $ABTestTrigger 去重缓存
+*/
+func (sensors *SensorsABTest) PurgeAllEvents() {
+	eventsLock.Lock()
+	defer eventsLock.Unlock()
+	eventsTime.Clear()
+	hitExperiments.Clear()
+}
+
+func removeEvents(match func(idEvent eventKey, hitExperiment beans.HitExperiment) bool) {
+	eventsLock.Lock()
+	defer eventsLock.Unlock()
+	var removedEvents []eventKey
+	hitExperiments.RemoveFunc(func(key lru.Key, value interface{}) bool {
+		if match(key.(eventKey), value.(beans.HitExperiment)) {
+			removedEvents = append(removedEvents, key.(eventKey))
+			return true
+		}
+		return false
+	})
+	for _, idEvent := range removedEvents {
+		eventsTime.Remove(idEvent)
+	}
+}
@@ -0,0 +1,102 @@
+package sensorsabtest_test
+
+import (
+	"testing"
+
+	sensorsabtest "github.com/sensorsdata/abtesting-sdk-go"
+	"github.com/sensorsdata/abtesting-sdk-go/abtesttest"
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+// 使用缓存读取参数，返回读取后服务端收到的请求数
+func fastFetch(t *testing.T, sensors *sensorsabtest.SensorsABTest, server *abtesttest.Server, distinctId string, customIDs map[string]string, paramName string, defaultValue interface{}) int {
+	t.Helper()
+	err, _ := sensors.FastFetchABTest(distinctId, true, beans.RequestParam{ParamName: paramName, DefaultValue: defaultValue, CustomIDs: customIDs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(server.Requests())
+}
+
+func TestInvalidateUser(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{
+		Results: []beans.InnerExperiment{testExperiment("exp_invalidate_user", "color", "red", "STRING")},
+	})
+	defer server.Close()
+	sensors, _ := newTestSDK(t, server)
+	device := map[string]string{"device": "d1"}
+
+	fastFetch(t, sensors, server, "invalidate_user", nil, "color", "blue")
+	fastFetch(t, sensors, server, "invalidate_user", device, "color", "blue")
+	if count := fastFetch(t, sensors, server, "invalidate_other", nil, "color", "blue"); count != 3 {
+		t.Fatalf("expected 3 requests, got %d", count)
+	}
+
+	// 只清除 distinctId 和自定义主体都一致的缓存
+	sensors.InvalidateUser("invalidate_user", true, nil)
+	if count := fastFetch(t, sensors, server, "invalidate_user", device, "color", "blue"); count != 3 {
+		t.Fatalf("user with custom IDs should stay cached, got %d requests", count)
+	}
+	if count := fastFetch(t, sensors, server, "invalidate_other", nil, "color", "blue"); count != 3 {
+		t.Fatalf("other user should stay cached, got %d requests", count)
+	}
+	if count := fastFetch(t, sensors, server, "invalidate_user", nil, "color", "blue"); count != 4 {
+		t.Fatalf("invalidated user should be fetched again, got %d requests", count)
+	}
+	// isLoginId 不同时不清除
+	sensors.InvalidateUser("invalidate_other", false, nil)
+	if count := fastFetch(t, sensors, server, "invalidate_other", nil, "color", "blue"); count != 4 {
+		t.Fatalf("login user should stay cached, got %d requests", count)
+	}
+}
+
+func TestInvalidateExperiment(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{
+		Results: []beans.InnerExperiment{
+			testExperiment("exp_invalidate_color", "color", "red", "STRING"),
+			testExperiment("exp_invalidate_size", "size", "10", "INTEGER"),
+		},
+	})
+	defer server.Close()
+	sensors, _ := newTestSDK(t, server)
+
+	fastFetch(t, sensors, server, "experiment_user_1", nil, "color", "blue")
+	if count := fastFetch(t, sensors, server, "experiment_user_2", nil, "color", "blue"); count != 2 {
+		t.Fatalf("expected 2 requests, got %d", count)
+	}
+
+	// 其他试验的缓存仍然有效，被清除的试验重新从网络获取
+	sensors.InvalidateExperiment("exp_invalidate_color")
+	if count := fastFetch(t, sensors, server, "experiment_user_1", nil, "size", 0); count != 2 {
+		t.Fatalf("other experiments should stay cached, got %d requests", count)
+	}
+	if count := fastFetch(t, sensors, server, "experiment_user_1", nil, "color", "blue"); count != 3 {
+		t.Fatalf("invalidated experiment should be fetched again, got %d requests", count)
+	}
+	if count := fastFetch(t, sensors, server, "experiment_user_2", nil, "color", "blue"); count != 4 {
+		t.Fatalf("invalidated experiment should be fetched again for every user, got %d requests", count)
+	}
+	// 重新获取后再次使用缓存
+	if count := fastFetch(t, sensors, server, "experiment_user_2", nil, "color", "blue"); count != 4 {
+		t.Fatalf("refetched experiment should be cached, got %d requests", count)
+	}
+}
+
+func TestPurgeAll(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{
+		Results: []beans.InnerExperiment{testExperiment("exp_purge", "color", "red", "STRING")},
+	})
+	defer server.Close()
+	sensors, _ := newTestSDK(t, server)
+	users := []string{"purge_user_1", "purge_user_2"}
+
+	for _, user := range users {
+		fastFetch(t, sensors, server, user, nil, "color", "blue")
+	}
+	sensors.PurgeAll()
+	for i, user := range users {
+		if count := fastFetch(t, sensors, server, user, nil, "color", "blue"); count != len(users)+i+1 {
+			t.Fatalf("%s should be fetched again after PurgeAll, got %d requests", user, count)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package sensorsabtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+func TestInvalidateUserEventsMatchesExactly(t *testing.T) {
+	sensors := &SensorsABTest{config: newSharedConfig(beans.ABTestConfig{EnableEventCache: true})}
+	initCache(beans.ABTestConfig{EventCacheSize: 16})
+
+	type cachedEvent struct {
+		distinctId string
+		customIDs  map[string]string
+		experiment beans.InnerExperiment
+		removed    bool
+	}
+	events := []cachedEvent{
+		// 试验 ID 和主体名称中包含 "$"
+		{"user", nil, beans.InnerExperiment{AbtestExperimentId: "exp$1", AbtestExperimentGroupId: "g$1"}, true},
+		{"user", nil, beans.InnerExperiment{AbtestExperimentId: "exp$2", SubjectId: "user", SubjectName: "US$ER"}, true},
+		// 以 "user$" 开头的其他用户和主体
+		{"user$other", nil, beans.InnerExperiment{AbtestExperimentId: "exp", AbtestExperimentGroupId: "g"}, false},
+		{"user", nil, beans.InnerExperiment{AbtestExperimentId: "exp", SubjectId: "user$other", SubjectName: "USER"}, false},
+		// 自定义主体不同
+		{"user", map[string]string{"device": "d1"}, beans.InnerExperiment{AbtestExperimentId: "exp", AbtestExperimentGroupId: "g"}, false},
+	}
+	for _, event := range events {
+		saveEvent2Cache(getEventKey(event.distinctId, event.customIDs, event.experiment), event.experiment, sensors)
+	}
+
+	sensors.InvalidateUserEvents("user", nil)
+	for _, event := range events {
+		notCached := isEventNotExistOrExpired(getEventKey(event.distinctId, event.customIDs, event.experiment), event.experiment, time.Hour)
+		if notCached != event.removed {
+			t.Errorf("event %+v: removed = %v, want %v", event, notCached, event.removed)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	sensorsabtest "github.com/sensorsdata/abtesting-sdk-go"
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+	"github.com/sensorsdata/abtesting-sdk-go/utils"
+)
+
+// 解析后的 Dump 内容
+type dumpReport struct {
+	Format       string            `json:"format"`
+	DistinctId   string            `json:"distinct_id"`
+	IsLoginId    bool              `json:"is_login_id"`
+	CustomIDs    map[string]string `json:"custom_ids,omitempty"`
+	Timestamp    int64             `json:"timestamp"`
+	AgeMs        int64             `json:"age_ms"`
+	ResultsCount int               `json:"results_count"`
+	OutListCount int               `json:"out_list_count"`
+	Valid        bool              `json:"valid"`
+	Error        string            `json:"error,omitempty"`
+	Assignments  []assignmentRow   `json:"assignments"`
+}
+
+func runDump(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: abctl dump <decode|verify> [flags] [dump]")
+	}
+	switch args[0] {
+	case "decode":
+		return runDumpDecode(args[1:])
+	case "verify":
+		return runDumpVerify(args[1:])
+	default:
+		return fmt.Errorf("unknown dump command %q", args[0])
+	}
+}
+
+func runDumpDecode(args []string) error {
+	flags := flag.NewFlagSet("dump decode", flag.ContinueOnError)
+	format := flags.String("format", formatTable, "输出格式，table 或 json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format != formatTable && *format != formatJSON {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	dump, err := readDumpArg(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	report, err := decodeDump(dump)
+	if err != nil {
+		return err
+	}
+	err = printDumpReport(os.Stdout, *format, report)
+	if err != nil {
+		return err
+	}
+	if !report.Valid {
+		return errors.New("dump is invalid: " + report.Error)
+	}
+	return nil
+}
+
+func runDumpVerify(args []string) error {
+	flags := flag.NewFlagSet("dump verify", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	dump, err := readDumpArg(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	report, err := decodeDump(dump)
+	if err != nil {
+		return err
+	}
+	if !report.Valid {
+		return errors.New("dump is invalid: " + report.Error)
+	}
+	fmt.Fprintf(os.Stdout, "OK: %s dump for %s, %d results, %d out_list\n", report.Format, report.DistinctId, report.ResultsCount, report.OutListCount)
+	return nil
+}
+
+// dump 从参数读取，参数为空或者为 - 时从标准输入读取
+func readDumpArg(args []string) (string, error) {
+	if len(args) > 1 {
+		return "", errors.New("expected a single dump argument")
+	}
+	if len(args) == 1 && args[0] != "-" {
+		return args[0], nil
+	}
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	dump := strings.TrimSpace(string(data))
+	if dump == "" {
+		return "", errors.New("empty dump")
+	}
+	return dump, nil
+}
+
+// 无法识别格式时返回错误，信封或响应体校验失败时返回 Valid 为 false 的结果，便于输出已解析的信息
+func decodeDump(dump string) (dumpReport, error) {
+	format, err := beans.DetectDumpFormat(dump)
+	if err != nil {
+		return dumpReport{}, err
+	}
+	report := dumpReport{Format: format.String()}
+	data, err := beans.DecodeDumpData(dump)
+	if err != nil {
+		report.Error = err.Error()
+		return report, nil
+	}
+
+	report.DistinctId = data.DistinctId
+	report.IsLoginId = data.IsLoginId
+	report.CustomIDs = data.CustomIDs
+	report.Timestamp = data.Timestamp
+	report.AgeMs = time.Now().UnixMilli() - data.Timestamp
+
+	response, err := utils.ParseResponse(data.ResponseBody)
+	if err != nil {
+		report.Error = "invalid response_body"
+		// 服务端错误响应的 error 字段可能为空
+		if err.Error() != "" {
+			report.Error += ": " + err.Error()
+		}
+		return report, nil
+	}
+	report.ResultsCount = len(response.Results)
+	report.OutListCount = len(response.OutList)
+
+	// 与 LoadAllExperiments 走相同的逻辑，不开启埋点，不会发送网络请求
+	var sensorsAB sensorsabtest.SensorsABTest
+	err, result := sensorsAB.LoadAllExperiments(data.DistinctId, data.IsLoginId, beans.LoadDumpedParam{CustomIDs: data.CustomIDs}, dump)
+	if err != nil {
+		report.Error = err.Error()
+		return report, nil
+	}
+	report.Assignments, err = buildAssignmentRows(result)
+	if err != nil {
+		report.Error = err.Error()
+		return report, nil
+	}
+	report.Valid = true
+	return report, nil
+}
+
+func printDumpReport(writer io.Writer, format string, report dumpReport) error {
+	if format == formatJSON {
+		if report.Assignments == nil {
+			report.Assignments = []assignmentRow{}
+		}
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "format:\t%s\n", report.Format)
+	fmt.Fprintf(table, "distinct_id:\t%s\n", report.DistinctId)
+	fmt.Fprintf(table, "is_login_id:\t%t\n", report.IsLoginId)
+	if len(report.CustomIDs) > 0 {
+		keys := make([]string, 0, len(report.CustomIDs))
+		for key := range report.CustomIDs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(table, "custom_id:\t%s=%s\n", key, report.CustomIDs[key])
+		}
+	}
+	// 信封无法解码或者旧版本 Dump 没有时间戳时不输出时间和时长
+	if report.Timestamp > 0 {
+		fmt.Fprintf(table, "timestamp:\t%d (%s, age %v)\n", report.Timestamp,
+			time.UnixMilli(report.Timestamp).Format(time.RFC3339), (time.Duration(report.AgeMs) * time.Millisecond).Round(time.Second))
+	} else {
+		fmt.Fprintf(table, "timestamp:\t%d\n", report.Timestamp)
+	}
+	fmt.Fprintf(table, "results:\t%d\n", report.ResultsCount)
+	fmt.Fprintf(table, "out_list:\t%d\n", report.OutListCount)
+	if report.Valid {
+		fmt.Fprintf(table, "valid:\ttrue\n")
+	} else {
+		fmt.Fprintf(table, "valid:\tfalse (%s)\n", report.Error)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	if !report.Valid {
+		return nil
+	}
+
+	fmt.Fprintln(writer)
+	return printAssignmentRows(writer, formatTable, report.Assignments)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+const testDumpResponseBody = `{"status":"SUCCESS","results":[{"abtest_experiment_id":"exp_color","abtest_experiment_group_id":"1",` +
+	`"abtest_experiment_result_id":"exp_color_result","variables":[{"name":"color","value":"red","type":"STRING"}]}],` +
+	`"out_list":[{"abtest_experiment_id":"exp_size","abtest_experiment_group_id":"0","abtest_experiment_result_id":"exp_size_result",` +
+	`"is_control_group":true,"variables":[{"name":"size","value":"10","type":"INTEGER"}]}]}`
+
+func encodeDump(t *testing.T, responseBody string, format beans.DumpFormat) string {
+	t.Helper()
+	dump, err := beans.EncodeDumpData(beans.DumpData{
+		DistinctId:   "dump_user",
+		IsLoginId:    true,
+		CustomIDs:    map[string]string{"device": "d1"},
+		ResponseBody: responseBody,
+		Timestamp:    1700000000000,
+	}, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dump
+}
+
+func TestDecodeDump(t *testing.T) {
+	wantRows := []assignmentRow{
+		{Param: "color", Value: "red", ExperimentId: "exp_color", GroupId: "1", ResultId: "exp_color_result"},
+		{Param: "size", Value: "10", ExperimentId: "exp_size", GroupId: "0", ResultId: "exp_size_result", IsControlGroup: true, OutList: true},
+	}
+	for _, format := range []beans.DumpFormat{beans.DumpFormatJSON, beans.DumpFormatBase64, beans.DumpFormatGzip} {
+		report, err := decodeDump(encodeDump(t, testDumpResponseBody, format))
+		if err != nil {
+			t.Fatalf("%v: %v", format, err)
+		}
+		if !report.Valid || report.Error != "" {
+			t.Fatalf("%v: expected a valid dump, got error %q", format, report.Error)
+		}
+		if report.Format != format.String() || report.DistinctId != "dump_user" || !report.IsLoginId ||
+			report.CustomIDs["device"] != "d1" || report.Timestamp != 1700000000000 || report.AgeMs <= 0 {
+			t.Fatalf("%v: unexpected report %+v", format, report)
+		}
+		if report.ResultsCount != 1 || report.OutListCount != 1 {
+			t.Fatalf("%v: results = %d, out_list = %d", format, report.ResultsCount, report.OutListCount)
+		}
+		if !reflect.DeepEqual(report.Assignments, wantRows) {
+			t.Fatalf("%v: assignments = %+v", format, report.Assignments)
+		}
+	}
+}
+
+func TestDecodeDumpCorruptEnvelope(t *testing.T) {
+	envelope := func(codec string, payload string) string {
+		return "v1." + codec + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+	}
+	tests := []struct {
+		name   string
+		dump   string
+		format string
+		error  string
+	}{
+		{name: "invalid base64", dump: "v1.gz.!!!", format: "gzip", error: "invalid serialized data: illegal base64 data"},
+		{name: "not gzip", dump: envelope("gz", "plain"), format: "gzip", error: "invalid serialized data: unexpected EOF"},
+		{name: "not json", dump: envelope("raw", "plain"), format: "base64", error: "invalid character 'p'"},
+		// 截断的 gzip 数据
+		{name: "truncated gzip", dump: encodeDump(t, testDumpResponseBody, beans.DumpFormatGzip)[:40], format: "gzip", error: "invalid serialized data:"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report, err := decodeDump(test.dump)
+			if err != nil {
+				t.Fatalf("a corrupt envelope should be reported, got %v", err)
+			}
+			if report.Valid || report.Format != test.format || !strings.HasPrefix(report.Error, test.error) {
+				t.Fatalf("report = %+v, want format %s and error %q", report, test.format, test.error)
+			}
+			if report.DistinctId != "" || report.Assignments != nil {
+				t.Fatalf("a corrupt envelope should not be parsed, got %+v", report)
+			}
+		})
+	}
+}
+
+func TestDecodeDumpUnknownFormat(t *testing.T) {
+	for _, dump := range []string{"v2.gz.H4sI", "v1.zstd.H4sI", "not a dump"} {
+		if _, err := decodeDump(dump); err == nil || err.Error() != "invalid serialized data: unknown dump format" {
+			t.Fatalf("%q: expected unknown format error, got %v", dump, err)
+		}
+	}
+}
+
+func TestDecodeDumpInvalidResponseBody(t *testing.T) {
+	tests := []struct {
+		name         string
+		responseBody string
+		error        string
+	}{
+		{name: "not json", responseBody: "not json", error: "invalid response_body: invalid character 'o' in literal null (expecting 'u')"},
+		{name: "failed response", responseBody: `{"status":"FAILED","error":"quota exceeded"}`, error: "invalid response_body: quota exceeded"},
+		// 服务端错误响应的 error 字段可能为空
+		{name: "failed response without error", responseBody: `{"status":"FAILED"}`, error: "invalid response_body"},
+		{name: "empty", responseBody: "", error: "invalid response_body: unexpected end of JSON input"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, format := range []beans.DumpFormat{beans.DumpFormatJSON, beans.DumpFormatGzip} {
+				report, err := decodeDump(encodeDump(t, test.responseBody, format))
+				if err != nil {
+					t.Fatalf("%v: %v", format, err)
+				}
+				if report.Valid || report.Error != test.error {
+					t.Fatalf("%v: valid = %t, error = %q, want %q", format, report.Valid, report.Error, test.error)
+				}
+				// 用户信息仍然可以输出
+				if report.DistinctId != "dump_user" || report.Assignments != nil {
+					t.Fatalf("%v: unexpected report %+v", format, report)
+				}
+			}
+		})
+	}
+}
+
+func TestPrintDumpReportInvalid(t *testing.T) {
+	report, err := decodeDump("v1.gz.!!!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output bytes.Buffer
+	if err = printDumpReport(&output, formatTable, report); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(output.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	text := strings.Join(lines, "\n")
+	if !strings.Contains(text, "\ntimestamp: 0\n") || !strings.Contains(text, "\nvalid: false (invalid serialized data: illegal base64 data") {
+		t.Fatalf("output:\n%s", output.String())
+	}
+	if strings.Contains(output.String(), "PARAM") {
+		t.Fatalf("an invalid dump should not print assignments:\n%s", output.String())
+	}
+}
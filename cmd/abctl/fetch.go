@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	sensorsabtest "github.com/sensorsdata/abtesting-sdk-go"
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+// 可重复的 key=value 参数
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for key, value := range f {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f keyValueFlag) Set(pair string) error {
+	index := strings.Index(pair, "=")
+	if index <= 0 {
+		return fmt.Errorf("expected key=value, got %q", pair)
+	}
+	f[pair[:index]] = pair[index+1:]
+	return nil
+}
+
+// 分流结果输出到 writer
+func runFetch(args []string, writer io.Writer) error {
+	flags := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	apiURL := flags.String("url", "", "A/B Testing 分流接口地址")
+	distinctId := flags.String("id", "", "用户的 distinct_id")
+	isLoginId := flags.Bool("login", false, "distinct_id 是否为登录 ID")
+	timeout := flags.Int("timeout", 3000, "网络请求超时时间，单位 ms")
+	format := flags.String("format", formatTable, "输出格式，table 或 json")
+	customIDs := keyValueFlag{}
+	flags.Var(customIDs, "custom-id", "自定义分流主体 key=value，可重复")
+	properties := keyValueFlag{}
+	flags.Var(properties, "prop", "自定义属性 key=value，可重复，数字和布尔值会自动转换")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *apiURL == "" {
+		return errors.New("-url is required")
+	}
+	if *distinctId == "" {
+		return errors.New("-id is required")
+	}
+	if *format != formatTable && *format != formatJSON {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	sensorsAB, err := sensorsabtest.New(*apiURL)
+	if err != nil {
+		return err
+	}
+
+	requestParam := beans.FetchAllRequestParam{
+		TimeoutMilliseconds: *timeout,
+		// 只用于查询，不触发 $ABTestTrigger 事件
+		EnableAutoTrackABEvent: false,
+	}
+	if len(customIDs) > 0 {
+		requestParam.CustomIDs = customIDs
+	}
+	if len(properties) > 0 {
+		requestParam.Properties = parseProperties(properties)
+	}
+
+	err, result := sensorsAB.FetchAllExperiments(*distinctId, *isLoginId, requestParam)
+	if err != nil {
+		return err
+	}
+
+	rows, err := buildAssignmentRows(result)
+	if err != nil {
+		return err
+	}
+	return printAssignmentRows(writer, *format, rows)
+}
+
+// 命令行中的属性值都是字符串，尽量还原为布尔值和数字
+func parseProperties(values map[string]string) map[string]interface{} {
+	properties := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		if intValue, err := strconv.Atoi(value); err == nil {
+			properties[key] = intValue
+		} else if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			properties[key] = floatValue
+		} else if value == "true" || value == "false" {
+			properties[key] = value == "true"
+		} else {
+			properties[key] = value
+		}
+	}
+	return properties
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sensorsdata/abtesting-sdk-go/abtesttest"
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+func newFetchServer() *abtesttest.Server {
+	return abtesttest.NewServer(abtesttest.Fixture{
+		Results: []beans.InnerExperiment{{
+			AbtestExperimentId:       "exp_color",
+			AbtestExperimentGroupId:  "1",
+			AbtestExperimentResultId: "exp_color_result",
+			AbtestExperimentVersion:  "2",
+			VariableList:             []beans.Variables{{Name: "color", Value: "red", Type: "STRING"}},
+		}},
+		OutList: []beans.InnerExperiment{{
+			AbtestExperimentId:       "exp_size",
+			AbtestExperimentGroupId:  "0",
+			AbtestExperimentResultId: "exp_size_result",
+			IsControlGroup:           true,
+			VariableList:             []beans.Variables{{Name: "size", Value: "10", Type: "INTEGER"}},
+		}},
+	})
+}
+
+func TestRunFetchTable(t *testing.T) {
+	server := newFetchServer()
+	defer server.Close()
+
+	var output bytes.Buffer
+	err := runFetch([]string{"-url", server.URL, "-id", "fetch_user", "-login",
+		"-custom-id", "device=d1", "-prop", "age=18", "-prop", "vip=true"}, &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 rows, got:\n%s", output.String())
+	}
+	if got := strings.Fields(lines[0]); strings.Join(got, " ") != "PARAM VALUE EXPERIMENT GROUP RESULT VERSION WHITELIST CONTROL OUT_LIST" {
+		t.Fatalf("header = %q", lines[0])
+	}
+	if got := strings.Join(strings.Fields(lines[1]), " "); got != "color red exp_color 1 exp_color_result 2 false false false" {
+		t.Fatalf("result row = %q", got)
+	}
+	// out_list 中的试验没有版本号，VERSION 列为空
+	if got := strings.Join(strings.Fields(lines[2]), " "); got != "size 10 exp_size 0 exp_size_result false true true" {
+		t.Fatalf("out_list row = %q", got)
+	}
+
+	requests := server.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	request := requests[0]
+	if request.DistinctId != "fetch_user" || !request.IsLoginId || request.CustomIDs["device"] != "d1" {
+		t.Fatalf("unexpected request %+v", request)
+	}
+	// 属性值按 JSON 解码，数字为 float64
+	if !reflect.DeepEqual(request.Properties, map[string]interface{}{"age": float64(18), "vip": true}) {
+		t.Fatalf("properties = %v", request.Properties)
+	}
+}
+
+func TestRunFetchJSON(t *testing.T) {
+	server := newFetchServer()
+	defer server.Close()
+
+	var output bytes.Buffer
+	if err := runFetch([]string{"-url", server.URL, "-id", "fetch_user", "-format", "json"}, &output); err != nil {
+		t.Fatal(err)
+	}
+	var rows []assignmentRow
+	if err := json.Unmarshal(output.Bytes(), &rows); err != nil {
+		t.Fatalf("invalid json output: %v\n%s", err, output.String())
+	}
+	want := []assignmentRow{
+		{Param: "color", Value: "red", ExperimentId: "exp_color", GroupId: "1", ResultId: "exp_color_result", Version: "2"},
+		{Param: "size", Value: "10", ExperimentId: "exp_size", GroupId: "0", ResultId: "exp_size_result", IsControlGroup: true, OutList: true},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows = %+v, want %+v", rows, want)
+	}
+	if requests := server.Requests(); len(requests) != 1 || requests[0].IsLoginId || requests[0].Properties != nil {
+		t.Fatalf("unexpected requests %+v", requests)
+	}
+}
+
+func TestRunFetchEmptyResult(t *testing.T) {
+	server := abtesttest.NewServer()
+	defer server.Close()
+
+	var output bytes.Buffer
+	if err := runFetch([]string{"-url", server.URL, "-id", "fetch_user"}, &output); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "no experiments\n" {
+		t.Fatalf("output = %q", output.String())
+	}
+	output.Reset()
+	if err := runFetch([]string{"-url", server.URL, "-id", "fetch_user", "-format", "json"}, &output); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(output.String()) != "[]" {
+		t.Fatalf("output = %q", output.String())
+	}
+}
+
+func TestRunFetchRejectsInvalidFlags(t *testing.T) {
+	cases := map[string][]string{
+		"-url is required":        {"-id", "u"},
+		"-id is required":         {"-url", "http://127.0.0.1:1"},
+		`unknown format "yaml"`:   {"-url", "http://127.0.0.1:1", "-id", "u", "-format", "yaml"},
+		`expected key=value, got`: {"-url", "http://127.0.0.1:1", "-id", "u", "-prop", "=b"},
+	}
+	for want, args := range cases {
+		var output bytes.Buffer
+		err := runFetch(args, &output)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("args %v: expected %q, got %v", args, want, err)
+		}
+		if output.Len() != 0 {
+			t.Fatalf("args %v: unexpected output %q", args, output.String())
+		}
+	}
+}
+
+func TestKeyValueFlagSet(t *testing.T) {
+	cases := []struct {
+		pair    string
+		want    keyValueFlag
+		wantErr bool
+	}{
+		{pair: "a=b", want: keyValueFlag{"a": "b"}},
+		{pair: "a=", want: keyValueFlag{"a": ""}},
+		// 只按第一个 = 分割，值中可以包含 =
+		{pair: "a=b=c", want: keyValueFlag{"a": "b=c"}},
+		{pair: "=b", wantErr: true},
+		{pair: "a", wantErr: true},
+		{pair: "", wantErr: true},
+	}
+	for _, c := range cases {
+		f := keyValueFlag{}
+		err := f.Set(c.pair)
+		if c.wantErr {
+			if err == nil || len(f) != 0 {
+				t.Fatalf("Set(%q): expected an error, got %v", c.pair, f)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Set(%q): %v", c.pair, err)
+		}
+		if !reflect.DeepEqual(f, c.want) {
+			t.Fatalf("Set(%q) = %v, want %v", c.pair, f, c.want)
+		}
+	}
+
+	// 重复的 key 以最后一次为准
+	f := keyValueFlag{}
+	_ = f.Set("a=1")
+	_ = f.Set("a=2")
+	if f["a"] != "2" {
+		t.Fatalf("repeated key = %q", f["a"])
+	}
+}
+
+func TestParseProperties(t *testing.T) {
+	got := parseProperties(map[string]string{
+		"int":      "42",
+		"negative": "-1",
+		"float":    "1.5",
+		"true":     "true",
+		"false":    "false",
+		"upper":    "TRUE",
+		"string":   "abc",
+		"empty":    "",
+		"equals":   "b=c",
+	})
+	want := map[string]interface{}{
+		"int":      42,
+		"negative": -1,
+		"float":    1.5,
+		"true":     true,
+		"false":    false,
+		"upper":    "TRUE",
+		"string":   "abc",
+		"empty":    "",
+		"equals":   "b=c",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseProperties = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,46 @@
+// abctl 是 A/B Testing SDK 的命令行工具，用于查询用户的分流结果以及解析 Dump 结果
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `abctl 查询用户的 A/B Testing 分流结果，解析 Dump 结果
+
+用法:
+  abctl fetch -url <API 地址> -id <distinct_id> [flags]
+        查询用户在所有试验下的分流结果
+  abctl dump decode [-format table|json] [dump|-]
+        解析 Dump 结果并输出每个参数的分流结果
+  abctl dump verify [dump|-]
+        校验 Dump 结果是否可以被 LoadAllExperiments 加载
+
+执行 abctl <command> -h 查看命令的参数说明
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "fetch":
+		err = runFetch(os.Args[2:], os.Stdout)
+	case "dump":
+		err = runDump(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "abctl:", err)
+		os.Exit(1)
+	}
+}
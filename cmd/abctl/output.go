@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+	"github.com/sensorsdata/abtesting-sdk-go/utils"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// 用户在一个试验参数上的分流结果
+type assignmentRow struct {
+	Param          string      `json:"param"`
+	Value          interface{} `json:"value"`
+	ExperimentId   string      `json:"experiment_id"`
+	GroupId        string      `json:"group_id"`
+	ResultId       string      `json:"result_id"`
+	Version        string      `json:"version,omitempty"`
+	IsWhiteList    bool        `json:"is_white_list"`
+	IsControlGroup bool        `json:"is_control_group"`
+	OutList        bool        `json:"out_list"`
+}
+
+// 命中的参数按照 GetValue 的结果输出，out_list 中的试验只埋点不返回值，单独输出
+func buildAssignmentRows(result beans.AllExperimentsResult) ([]assignmentRow, error) {
+	var rows []assignmentRow
+	for _, paramName := range result.ParamNames() {
+		experiment := result.GetExperiment(paramName, nil).InternalExperiment
+		rows = append(rows, newAssignmentRow(paramName, experiment.Result, experiment, false))
+	}
+
+	if result.ResponseBody() == "" {
+		return rows, nil
+	}
+	response, err := utils.ParseResponse(result.ResponseBody())
+	if err != nil {
+		return rows, err
+	}
+	for _, experiment := range response.OutList {
+		for _, variable := range experiment.VariableList {
+			rows = append(rows, newAssignmentRow(variable.Name, variable.Value, experiment, true))
+		}
+	}
+	return rows, nil
+}
+
+func newAssignmentRow(paramName string, value interface{}, experiment beans.InnerExperiment, outList bool) assignmentRow {
+	return assignmentRow{
+		Param:          paramName,
+		Value:          value,
+		ExperimentId:   experiment.AbtestExperimentId,
+		GroupId:        experiment.AbtestExperimentGroupId,
+		ResultId:       experiment.AbtestExperimentResultId,
+		Version:        experiment.AbtestExperimentVersion,
+		IsWhiteList:    experiment.IsWhiteList,
+		IsControlGroup: experiment.IsControlGroup,
+		OutList:        outList,
+	}
+}
+
+func printAssignmentRows(writer io.Writer, format string, rows []assignmentRow) error {
+	if format == formatJSON {
+		if rows == nil {
+			rows = []assignmentRow{}
+		}
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	}
+
+	if len(rows) == 0 {
+		_, err := fmt.Fprintln(writer, "no experiments")
+		return err
+	}
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "PARAM\tVALUE\tEXPERIMENT\tGROUP\tRESULT\tVERSION\tWHITELIST\tCONTROL\tOUT_LIST")
+	for _, row := range rows {
+		fmt.Fprintf(table, "%s\t%v\t%s\t%s\t%s\t%s\t%t\t%t\t%t\n", row.Param, row.Value, row.ExperimentId, row.GroupId,
+			row.ResultId, row.Version, row.IsWhiteList, row.IsControlGroup, row.OutList)
+	}
+	return table.Flush()
+}
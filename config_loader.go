@@ -0,0 +1,234 @@
+package sensorsabtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+	"gopkg.in/yaml.v3"
+)
+
+// 环境变量与配置项的对应关系，环境变量优先于配置文件
+var envConfigSetters = []struct {
+	name string
+	set  func(config *beans.FileConfig, value string) error
+}{
+	{"SENSORS_AB_API_URL", stringEnvSetter(func(config *beans.FileConfig) *string { return &config.APIUrl })},
+	{"SENSORS_AB_ENDPOINTS", func(config *beans.FileConfig, value string) error {
+		config.Endpoints = nil
+		for _, endpoint := range strings.Split(value, ",") {
+			if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+				config.Endpoints = append(config.Endpoints, endpoint)
+			}
+		}
+		return nil
+	}},
+	{"SENSORS_AB_ENDPOINT_POLICY", stringEnvSetter(func(config *beans.FileConfig) *string { return &config.EndpointPolicy })},
+	{"SENSORS_AB_ENDPOINT_FAILURE_THRESHOLD", intEnvSetter(func(config *beans.FileConfig) *int { return &config.EndpointFailureThreshold })},
+	{"SENSORS_AB_ENDPOINT_EJECTION", durationEnvSetter(func(config *beans.FileConfig) *beans.Duration { return &config.EndpointEjection })},
+	{"SENSORS_AB_HEDGING", boolEnvSetter(func(config *beans.FileConfig) *bool { return &config.Hedging })},
+	{"SENSORS_AB_HEDGING_DELAY", durationEnvSetter(func(config *beans.FileConfig) *beans.Duration { return &config.HedgingDelay })},
+	{"SENSORS_AB_HEDGING_MAX_PERCENT", intEnvSetter(func(config *beans.FileConfig) *int { return &config.HedgingMaxPercent })},
+	{"SENSORS_AB_EXPERIMENT_CACHE_SIZE", intEnvSetter(func(config *beans.FileConfig) *int { return &config.ExperimentCacheSize })},
+	{"SENSORS_AB_EXPERIMENT_CACHE_TTL", durationEnvSetter(func(config *beans.FileConfig) *beans.Duration { return &config.ExperimentCacheTTL })},
+	{"SENSORS_AB_EVENT_CACHE_SIZE", intEnvSetter(func(config *beans.FileConfig) *int { return &config.EventCacheSize })},
+	{"SENSORS_AB_EVENT_CACHE_TTL", durationEnvSetter(func(config *beans.FileConfig) *beans.Duration { return &config.EventCacheTTL })},
+	{"SENSORS_AB_ENABLE_EVENT_CACHE", boolEnvSetter(func(config *beans.FileConfig) *bool { return &config.EnableEventCache })},
+	{"SENSORS_AB_ENABLE_RECORD_REQUEST_COST_TIME", boolEnvSetter(func(config *beans.FileConfig) *bool { return &config.EnableRecordRequestCostTime })},
+	{"SENSORS_AB_REQUEST_TIMEOUT", durationEnvSetter(func(config *beans.FileConfig) *beans.Duration { return &config.RequestTimeout })},
+	{"SENSORS_AB_MAX_RETRIES", intEnvSetter(func(config *beans.FileConfig) *int { return &config.MaxRetries })},
+	{"SENSORS_AB_RETRY_BACKOFF", durationEnvSetter(func(config *beans.FileConfig) *beans.Duration { return &config.RetryBackoff })},
+	{"SENSORS_AB_REQUEST_GZIP", boolEnvSetter(func(config *beans.FileConfig) *bool { return &config.RequestGzip })},
+	{"SENSORS_AB_REQUEST_GZIP_MIN_BYTES", intEnvSetter(func(config *beans.FileConfig) *int { return &config.RequestGzipMinBytes })},
+	{"SENSORS_AB_RESPONSE_GZIP", boolEnvSetter(func(config *beans.FileConfig) *bool { return &config.ResponseGzip })},
+	{"SENSORS_AB_MAX_RESPONSE_BYTES", intEnvSetter(func(config *beans.FileConfig) *int { return &config.MaxResponseBytes })},
+	{"SENSORS_AB_HTTP_MAX_IDLE_CONNS_PER_HOST", intEnvSetter(func(config *beans.FileConfig) *int { return &config.HTTPTransport.MaxIdleConnsPerHost })},
+	{"SENSORS_AB_HTTP_MAX_IDLE_CONNS", intEnvSetter(func(config *beans.FileConfig) *int { return &config.HTTPTransport.MaxIdleConns })},
+	{"SENSORS_AB_HTTP_MAX_CONNS_PER_HOST", intEnvSetter(func(config *beans.FileConfig) *int { return &config.HTTPTransport.MaxConnsPerHost })},
+	{"SENSORS_AB_HTTP_IDLE_CONN_TIMEOUT", durationEnvSetter(func(config *beans.FileConfig) *beans.Duration { return &config.HTTPTransport.IdleConnTimeout })},
+	{"SENSORS_AB_HTTP_DIAL_TIMEOUT", durationEnvSetter(func(config *beans.FileConfig) *beans.Duration { return &config.HTTPTransport.DialTimeout })},
+	{"SENSORS_AB_HTTP_DIAL_KEEP_ALIVE", durationEnvSetter(func(config *beans.FileConfig) *beans.Duration { return &config.HTTPTransport.DialKeepAlive })},
+	{"SENSORS_AB_HTTP_CA_FILE", stringEnvSetter(func(config *beans.FileConfig) *string { return &config.HTTPTransport.CAFile })},
+	{"SENSORS_AB_HTTP_CERT_FILE", stringEnvSetter(func(config *beans.FileConfig) *string { return &config.HTTPTransport.CertFile })},
+	{"SENSORS_AB_HTTP_KEY_FILE", stringEnvSetter(func(config *beans.FileConfig) *string { return &config.HTTPTransport.KeyFile })},
+	{"SENSORS_AB_HTTP_PROXY_URL", stringEnvSetter(func(config *beans.FileConfig) *string { return &config.HTTPTransport.ProxyURL })},
+}
+
+/*
+读取 SDK 配置
+path 为 .yaml、.yml 或 .json 文件，为空时只读取环境变量；文件中包含未知的配置项时返回错误
+SENSORS_AB_* 环境变量会覆盖文件中的配置
+*/
+func LoadFileConfig(path string) (beans.FileConfig, error) {
+	var config beans.FileConfig
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return config, fmt.Errorf("failed to read config file: %w", err)
+		}
+		// 严格解析，拼写错误的配置项返回错误，而不是被忽略后使用默认值
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml":
+			decoder := yaml.NewDecoder(bytes.NewReader(data))
+			decoder.KnownFields(true)
+			err = decoder.Decode(&config)
+			if errors.Is(err, io.EOF) {
+				// 空文件
+				err = nil
+			}
+		case ".json":
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			decoder.DisallowUnknownFields()
+			err = decoder.Decode(&config)
+		default:
+			return config, fmt.Errorf("unsupported config file %s, expected .yaml, .yml or .json", path)
+		}
+		if err != nil {
+			return config, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	for _, setter := range envConfigSetters {
+		value, ok := os.LookupEnv(setter.name)
+		if !ok || value == "" {
+			continue
+		}
+		if err := setter.set(&config, value); err != nil {
+			return config, fmt.Errorf("invalid environment variable %s: %w", setter.name, err)
+		}
+	}
+	return config, nil
+}
+
+/*
+根据 LoadFileConfig 读取的配置创建 SensorsABTest
+未设置的配置项使用默认值，配置项按照 Option 的规则校验，opts 在配置文件之后生效，用于设置 SensorsAnalytics 等无法写在文件中的配置
+*/
+func NewFromFileConfig(config beans.FileConfig, opts ...Option) (*SensorsABTest, error) {
+	fileOpts, err := fileConfigOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	return New(config.APIUrl, append(fileOpts, opts...)...)
+}
+
+// 将配置文件转换为 Option，为 0 的配置项不生成 Option
+func fileConfigOptions(config beans.FileConfig) ([]Option, error) {
+	var opts []Option
+	if len(config.Endpoints) > 0 || config.EndpointPolicy != "" || config.EndpointFailureThreshold != 0 || config.EndpointEjection != 0 {
+		policy := beans.EndpointPolicyFailover
+		if config.EndpointPolicy != "" {
+			var err error
+			policy, err = beans.ParseEndpointPolicy(config.EndpointPolicy)
+			if err != nil {
+				return nil, &ConfigError{Field: "EndpointPolicy", Value: config.EndpointPolicy, Reason: err.Error()}
+			}
+		}
+		opts = append(opts, WithEndpoints(beans.EndpointParam{
+			URLs:                 config.Endpoints,
+			Policy:               policy,
+			FailureThreshold:     config.EndpointFailureThreshold,
+			EjectionMilliSeconds: durationMilliseconds(config.EndpointEjection),
+		}))
+	}
+	if config.Hedging {
+		opts = append(opts, WithHedging(beans.HedgingParam{
+			Enable:            true,
+			DelayMilliSeconds: durationMilliseconds(config.HedgingDelay),
+			MaxPercent:        config.HedgingMaxPercent,
+		}))
+	}
+	if config.ExperimentCacheSize != 0 {
+		opts = append(opts, WithExperimentCacheSize(config.ExperimentCacheSize))
+	}
+	if config.ExperimentCacheTTL != 0 {
+		opts = append(opts, WithExperimentCacheTTL(config.ExperimentCacheTTL.Duration()))
+	}
+	if config.EventCacheSize != 0 {
+		opts = append(opts, WithEventCacheSize(config.EventCacheSize))
+	}
+	if config.EventCacheTTL != 0 {
+		opts = append(opts, WithEventCacheTTL(config.EventCacheTTL.Duration()))
+	}
+	if config.RequestTimeout != 0 {
+		opts = append(opts, WithRequestTimeout(config.RequestTimeout.Duration()))
+	}
+	if config.MaxRetries != 0 || config.RetryBackoff != 0 {
+		opts = append(opts, WithRetry(config.MaxRetries, config.RetryBackoff.Duration()))
+	}
+	opts = append(opts,
+		WithEventCache(config.EnableEventCache),
+		WithRequestCostTimeRecording(config.EnableRecordRequestCostTime),
+		WithCompression(beans.CompressionParam{
+			EnableRequestGzip:   config.RequestGzip,
+			RequestGzipMinBytes: config.RequestGzipMinBytes,
+			EnableResponseGzip:  config.ResponseGzip,
+		}),
+		WithResponseLimit(beans.ResponseParam{MaxBytes: config.MaxResponseBytes}),
+		WithHTTPTransport(beans.HTTPTransportParam{
+			MaxIdleConnsPerHost:         config.HTTPTransport.MaxIdleConnsPerHost,
+			MaxIdleConns:                config.HTTPTransport.MaxIdleConns,
+			MaxConnsPerHost:             config.HTTPTransport.MaxConnsPerHost,
+			IdleConnTimeoutMilliSeconds: durationMilliseconds(config.HTTPTransport.IdleConnTimeout),
+			DialTimeoutMilliSeconds:     durationMilliseconds(config.HTTPTransport.DialTimeout),
+			DialKeepAliveMilliSeconds:   durationMilliseconds(config.HTTPTransport.DialKeepAlive),
+			CAFile:                      config.HTTPTransport.CAFile,
+			CertFile:                    config.HTTPTransport.CertFile,
+			KeyFile:                     config.HTTPTransport.KeyFile,
+			ProxyURL:                    config.HTTPTransport.ProxyURL,
+		}),
+	)
+	return opts, nil
+}
+
+func durationMilliseconds(duration beans.Duration) int {
+	return int(duration.Duration().Milliseconds())
+}
+
+func stringEnvSetter(field func(config *beans.FileConfig) *string) func(config *beans.FileConfig, value string) error {
+	return func(config *beans.FileConfig, value string) error {
+		*field(config) = value
+		return nil
+	}
+}
+
+func intEnvSetter(field func(config *beans.FileConfig) *int) func(config *beans.FileConfig, value string) error {
+	return func(config *beans.FileConfig, value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(config) = parsed
+		return nil
+	}
+}
+
+func boolEnvSetter(field func(config *beans.FileConfig) *bool) func(config *beans.FileConfig, value string) error {
+	return func(config *beans.FileConfig, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(config) = parsed
+		return nil
+	}
+}
+
+func durationEnvSetter(field func(config *beans.FileConfig) *beans.Duration) func(config *beans.FileConfig, value string) error {
+	return func(config *beans.FileConfig, value string) error {
+		parsed, err := beans.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*field(config) = parsed
+		return nil
+	}
+}
@@ -0,0 +1,162 @@
+package sensorsabtest_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	sensorsabtest "github.com/sensorsdata/abtesting-sdk-go"
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+func writeConfigFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFileConfig(t *testing.T) {
+	want := beans.FileConfig{
+		APIUrl:              "http://ab.example.com/api/v2/abtest/online/results",
+		Endpoints:           []string{"http://backup.example.com"},
+		ExperimentCacheTTL:  beans.Duration(10 * time.Minute),
+		RequestTimeout:      beans.Duration(500 * time.Millisecond),
+		MaxRetries:          2,
+		RequestGzip:         true,
+		HTTPTransport:       beans.FileTransportConfig{DialTimeout: beans.Duration(time.Second)},
+		ExperimentCacheSize: 1000,
+	}
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "config.yaml", content: `
+api_url: http://ab.example.com/api/v2/abtest/online/results
+endpoints: [http://backup.example.com]
+experiment_cache_size: 1000
+experiment_cache_ttl: 10m
+request_timeout: 500
+max_retries: 2
+request_gzip: true
+http_transport:
+  dial_timeout: 1s
+`},
+		{name: "config.JSON", content: `{
+	"api_url": "http://ab.example.com/api/v2/abtest/online/results",
+	"endpoints": ["http://backup.example.com"],
+	"experiment_cache_size": 1000,
+	"experiment_cache_ttl": "10m",
+	"request_timeout": 500,
+	"max_retries": 2,
+	"request_gzip": true,
+	"http_transport": {"dial_timeout": "1s"}
+}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := sensorsabtest.LoadFileConfig(writeConfigFile(t, test.name, test.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(config, want) {
+				t.Fatalf("config = %+v, want %+v", config, want)
+			}
+		})
+	}
+}
+
+func TestLoadFileConfigRejectsInvalidFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		reason  string
+	}{
+		{name: "unknown.yaml", content: "api_url: http://ab.example.com\nrequest_timout: 1s\n", reason: "request_timout"},
+		{name: "unknown_nested.yml", content: "http_transport:\n  proxy: http://proxy\n", reason: "proxy"},
+		{name: "unknown.json", content: `{"api_url": "http://ab.example.com", "max_retry": 2}`, reason: "max_retry"},
+		{name: "duration.yaml", content: "request_timeout: soon\n", reason: "invalid duration"},
+		{name: "config.toml", content: "api_url = 'http://ab.example.com'", reason: "unsupported config file"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := sensorsabtest.LoadFileConfig(writeConfigFile(t, test.name, test.content))
+			if err == nil || !strings.Contains(err.Error(), test.reason) {
+				t.Fatalf("expected error containing %q, got %v", test.reason, err)
+			}
+		})
+	}
+	if _, err := sensorsabtest.LoadFileConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("expected error for a missing file")
+	}
+}
+
+func TestLoadFileConfigEmptyYAML(t *testing.T) {
+	config, err := sensorsabtest.LoadFileConfig(writeConfigFile(t, "empty.yaml", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config, beans.FileConfig{}) {
+		t.Fatalf("config = %+v", config)
+	}
+}
+
+func TestLoadFileConfigFromEnv(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "api_url: http://file.example.com\nmax_retries: 1\nrequest_gzip: true\n")
+	t.Setenv("SENSORS_AB_API_URL", "http://env.example.com")
+	t.Setenv("SENSORS_AB_ENDPOINTS", " http://a.example.com, ,http://b.example.com ")
+	t.Setenv("SENSORS_AB_MAX_RETRIES", "3")
+	t.Setenv("SENSORS_AB_RETRY_BACKOFF", "250ms")
+	t.Setenv("SENSORS_AB_HTTP_PROXY_URL", "http://proxy.example.com:3128")
+	// 空的环境变量不覆盖文件中的配置
+	t.Setenv("SENSORS_AB_REQUEST_GZIP", "")
+
+	config, err := sensorsabtest.LoadFileConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := beans.FileConfig{
+		APIUrl:        "http://env.example.com",
+		Endpoints:     []string{"http://a.example.com", "http://b.example.com"},
+		MaxRetries:    3,
+		RetryBackoff:  beans.Duration(250 * time.Millisecond),
+		RequestGzip:   true,
+		HTTPTransport: beans.FileTransportConfig{ProxyURL: "http://proxy.example.com:3128"},
+	}
+	if !reflect.DeepEqual(config, want) {
+		t.Fatalf("config = %+v, want %+v", config, want)
+	}
+
+	// 没有配置文件时只读取环境变量
+	config, err = sensorsabtest.LoadFileConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.APIUrl != "http://env.example.com" || config.MaxRetries != 3 || config.RequestGzip {
+		t.Fatalf("config = %+v", config)
+	}
+}
+
+func TestLoadFileConfigRejectsInvalidEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "SENSORS_AB_MAX_RETRIES", value: "three"},
+		{name: "SENSORS_AB_HEDGING", value: "maybe"},
+		{name: "SENSORS_AB_EXPERIMENT_CACHE_TTL", value: "forever"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(test.name, test.value)
+			if _, err := sensorsabtest.LoadFileConfig(""); err == nil || !strings.Contains(err.Error(), test.name) {
+				t.Fatalf("expected error naming %s, got %v", test.name, err)
+			}
+		})
+	}
+}
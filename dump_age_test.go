@@ -0,0 +1,54 @@
+package sensorsabtest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+func TestCheckDumpAge(t *testing.T) {
+	now := time.Now().UnixMilli()
+	minute := time.Minute.Milliseconds()
+	tests := []struct {
+		name      string
+		timestamp int64
+		param     beans.LoadDumpedParam
+		expired   bool
+	}{
+		{name: "no max age", timestamp: now - 60*minute, param: beans.LoadDumpedParam{}},
+		{name: "no max age without timestamp", timestamp: 0, param: beans.LoadDumpedParam{}},
+		{name: "fresh", timestamp: now - minute, param: beans.LoadDumpedParam{MaxAge: 5 * time.Minute}},
+		{name: "expired", timestamp: now - 10*minute, param: beans.LoadDumpedParam{MaxAge: 5 * time.Minute}, expired: true},
+		{name: "expired within tolerance", timestamp: now - 6*minute, param: beans.LoadDumpedParam{MaxAge: 5 * time.Minute, ClockSkewTolerance: 2 * time.Minute}},
+		{name: "expired beyond tolerance", timestamp: now - 8*minute, param: beans.LoadDumpedParam{MaxAge: 5 * time.Minute, ClockSkewTolerance: 2 * time.Minute}, expired: true},
+		{name: "future without tolerance", timestamp: now + minute, param: beans.LoadDumpedParam{MaxAge: 5 * time.Minute}, expired: true},
+		{name: "future within tolerance", timestamp: now + minute, param: beans.LoadDumpedParam{MaxAge: 5 * time.Minute, ClockSkewTolerance: 2 * time.Minute}},
+		{name: "future beyond tolerance", timestamp: now + 3*minute, param: beans.LoadDumpedParam{MaxAge: 5 * time.Minute, ClockSkewTolerance: 2 * time.Minute}, expired: true},
+		{name: "negative tolerance", timestamp: now + minute, param: beans.LoadDumpedParam{MaxAge: 5 * time.Minute, ClockSkewTolerance: -time.Hour}, expired: true},
+		// 旧版本 SDK 生成的数据没有时间戳，设置 MaxAge 后总是过期
+		{name: "missing timestamp", timestamp: 0, param: beans.LoadDumpedParam{MaxAge: 24 * time.Hour, ClockSkewTolerance: time.Hour}, expired: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkDumpAge(beans.DumpData{Timestamp: test.timestamp}, test.param)
+			if !test.expired {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				return
+			}
+			var expiredError *DumpExpiredError
+			if !errors.As(err, &expiredError) {
+				t.Fatalf("expected DumpExpiredError, got %v", err)
+			}
+			if expiredError.Timestamp != test.timestamp || expiredError.MaxAge != test.param.MaxAge {
+				t.Fatalf("unexpected error fields %+v", expiredError)
+			}
+			if future := test.timestamp > now; future != (expiredError.Age < 0) {
+				t.Fatalf("Age = %v for timestamp offset %dms", expiredError.Age, test.timestamp-now)
+			}
+		})
+	}
+}
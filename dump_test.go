@@ -0,0 +1,144 @@
+package sensorsabtest_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	sensorsabtest "github.com/sensorsdata/abtesting-sdk-go"
+	"github.com/sensorsdata/abtesting-sdk-go/abtesttest"
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+const dumpTestBody = `{"status":"SUCCESS","results":[{"abtest_experiment_id":"exp_dump","abtest_experiment_group_id":"0","abtest_experiment_result_id":"r","variables":[{"name":"color","value":"red","type":"STRING"}]}]}`
+
+func encodeTestDump(t *testing.T, timestamp int64) string {
+	t.Helper()
+	dump, err := beans.EncodeDumpData(beans.DumpData{
+		DistinctId:   "dump_user",
+		IsLoginId:    true,
+		ResponseBody: dumpTestBody,
+		Timestamp:    timestamp,
+	}, beans.DumpFormatGzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dump
+}
+
+func TestLoadAllExperimentsMaxAge(t *testing.T) {
+	server := abtesttest.NewServer()
+	defer server.Close()
+	sensors, _ := newTestSDK(t, server)
+	param := beans.LoadDumpedParam{MaxAge: time.Minute, ClockSkewTolerance: 10 * time.Second}
+
+	err, result := sensors.LoadAllExperiments("dump_user", true, param, encodeTestDump(t, time.Now().Add(-30*time.Second).UnixMilli()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := result.GetValue("color", "blue"); value != "red" {
+		t.Fatalf("color = %v", value)
+	}
+
+	tests := []struct {
+		name      string
+		timestamp int64
+	}{
+		{name: "expired", timestamp: time.Now().Add(-2 * time.Minute).UnixMilli()},
+		{name: "future", timestamp: time.Now().Add(time.Minute).UnixMilli()},
+		{name: "missing timestamp", timestamp: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err, _ := sensors.LoadAllExperiments("dump_user", true, param, encodeTestDump(t, test.timestamp))
+			var expiredError *sensorsabtest.DumpExpiredError
+			if !errors.As(err, &expiredError) || expiredError.Timestamp != test.timestamp {
+				t.Fatalf("expected DumpExpiredError, got %v", err)
+			}
+		})
+	}
+	// 没有设置 MaxAge 时不校验时间戳
+	if err, _ := sensors.LoadAllExperiments("dump_user", true, beans.LoadDumpedParam{}, encodeTestDump(t, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.Requests()) != 0 {
+		t.Fatalf("expired dumps should not be refreshed, got %d requests", len(server.Requests()))
+	}
+}
+
+func TestLoadAllExperimentsRefreshOnExpired(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{
+		Results: []beans.InnerExperiment{testExperiment("exp_refresh", "color", "green", "STRING")},
+	})
+	defer server.Close()
+	sensors, _ := newTestSDK(t, server)
+	param := beans.LoadDumpedParam{
+		MaxAge:           time.Minute,
+		RefreshOnExpired: true,
+		Properties:       map[string]interface{}{"city": "beijing"},
+	}
+
+	// 未过期时使用序列化数据，不发送请求
+	err, result := sensors.LoadAllExperiments("dump_user", true, param, encodeTestDump(t, time.Now().UnixMilli()))
+	if err != nil || result.GetValue("color", "blue") != "red" || len(server.Requests()) != 0 {
+		t.Fatalf("err = %v, color = %v, requests = %d", err, result.GetValue("color", "blue"), len(server.Requests()))
+	}
+
+	// 过期后从网络重新拉取
+	err, result = sensors.LoadAllExperiments("dump_user", true, param, encodeTestDump(t, time.Now().Add(-time.Hour).UnixMilli()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := result.GetValue("color", "blue"); value != "green" {
+		t.Fatalf("refreshed color = %v", value)
+	}
+	requests := server.Requests()
+	if len(requests) != 1 || requests[0].DistinctId != "dump_user" || requests[0].Properties["city"] != "beijing" {
+		t.Fatalf("unexpected refresh requests %+v", requests)
+	}
+}
+
+func TestDumpParamsRoundTrip(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{
+		Results: []beans.InnerExperiment{
+			testExperiment("exp_params_color", "color", "red", "STRING"),
+			testExperiment("exp_params_size", "size", "10", "INTEGER"),
+		},
+		TrackConfig: &beans.TrackConfig{TriggerSwitch: true, PropertySetSwitch: true},
+	})
+	defer server.Close()
+	sensors, events := newTestSDK(t, server)
+	err, result := sensors.FetchAllExperiments("params_user", true, beans.FetchAllRequestParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 未知的参数名被忽略
+	dump, err := result.DumpParamsWithFormat(beans.DumpFormatGzip, "color", "unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err, loaded := sensors.LoadAllExperiments("params_user", true, beans.LoadDumpedParam{EnableAutoTrackABEvent: true}, dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := loaded.GetValue("color", "blue"); value != "red" {
+		t.Fatalf("color = %v", value)
+	}
+	// 没有序列化的参数返回默认值
+	if value := loaded.GetValue("size", 0); value != 0 {
+		t.Fatalf("size = %v", value)
+	}
+	if value := loaded.GetValue("unknown", "default"); value != "default" {
+		t.Fatalf("unknown = %v", value)
+	}
+
+	// 保留的 track_config 决定加载后的埋点内容
+	tracked := events()
+	if ids := trackedExperimentIds(tracked); len(ids) != 1 || ids[0] != "exp_params_color" {
+		t.Fatalf("tracked experiments = %v", ids)
+	}
+	if _, ok := tracked[0].Properties["abtest_result"]; !ok {
+		t.Fatalf("track_config is lost after DumpParams: %+v", tracked[0].Properties)
+	}
+}
@@ -0,0 +1,188 @@
+package sensorsabtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+const (
+	defaultEndpointFailureThreshold = 3
+	defaultEndpointEjection         = 30 * time.Second
+	// 平均耗时的平滑系数，越大越偏向最近的请求
+	endpointLatencyWeight = 0.3
+)
+
+// 单个分流接口地址的健康状态
+type endpoint struct {
+	url                 string
+	consecutiveFailures int
+	// 摘除到期的时间，为零值表示健康
+	ejectedUntil time.Time
+	// 摘除到期后是否已经放行了探测请求
+	probing bool
+	// 平均耗时，为 0 表示还没有成功的请求
+	latency time.Duration
+}
+
+// 根据被动健康检查选择分流接口地址
+type endpointPool struct {
+	lock      sync.Mutex
+	policy    beans.EndpointPolicy
+	threshold int
+	ejection  time.Duration
+	endpoints []*endpoint
+	next      int
+}
+
+// 根据配置创建 endpointPool，APIUrl 排在第一位，重复的地址只保留一个
+func newEndpointPool(config beans.ABTestConfig) *endpointPool {
+	pool := &endpointPool{
+		policy:    config.EndpointParam.Policy,
+		threshold: config.EndpointParam.FailureThreshold,
+		ejection:  time.Duration(config.EndpointParam.EjectionMilliSeconds) * time.Millisecond,
+	}
+	if pool.threshold <= 0 {
+		pool.threshold = defaultEndpointFailureThreshold
+	}
+	if pool.ejection <= 0 {
+		pool.ejection = defaultEndpointEjection
+	}
+	seen := make(map[string]bool)
+	for _, url := range append([]string{config.APIUrl}, config.EndpointParam.URLs...) {
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		pool.endpoints = append(pool.endpoints, &endpoint{url: url})
+	}
+	return pool
+}
+
+func (pool *endpointPool) size() int {
+	if pool == nil {
+		return 0
+	}
+	return len(pool.endpoints)
+}
+
+/*
+选择一个地址，tried 中的地址不会再次选择
+优先选择健康的地址，没有健康的地址时选择摘除到期可以探测的地址；所有地址都被摘除时返回最早到期的地址，避免完全无法请求
+存在健康的地址时，摘除到期的地址由 startProbe 在请求之外探测
+*/
+func (pool *endpointPool) choose(tried map[string]bool) (string, bool) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	now := time.Now()
+
+	var healthy []*endpoint
+	var probe *endpoint
+	var earliest *endpoint
+	for _, candidate := range pool.endpoints {
+		if tried[candidate.url] {
+			continue
+		}
+		if candidate.ejectedUntil.IsZero() {
+			healthy = append(healthy, candidate)
+			continue
+		}
+		if !candidate.ejectedUntil.After(now) && !candidate.probing && probe == nil {
+			probe = candidate
+		}
+		if earliest == nil || candidate.ejectedUntil.Before(earliest.ejectedUntil) {
+			earliest = candidate
+		}
+	}
+
+	if len(healthy) > 0 {
+		return pool.pick(healthy).url, true
+	}
+	if probe != nil {
+		probe.probing = true
+		return probe.url, true
+	}
+	if earliest != nil {
+		return earliest.url, true
+	}
+	return "", false
+}
+
+// 选择一个摘除到期并且没有在探测的地址，标记为探测中，探测结果通过 report 记录
+func (pool *endpointPool) startProbe() (string, bool) {
+	if pool.size() == 0 {
+		return "", false
+	}
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	now := time.Now()
+	for _, candidate := range pool.endpoints {
+		if !candidate.ejectedUntil.IsZero() && !candidate.ejectedUntil.After(now) && !candidate.probing {
+			candidate.probing = true
+			return candidate.url, true
+		}
+	}
+	return "", false
+}
+
+// 取消没有发出或者没有结果的探测请求，不修改地址的健康状态
+func (pool *endpointPool) cancelProbe(url string) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	for _, target := range pool.endpoints {
+		if target.url == url {
+			target.probing = false
+			return
+		}
+	}
+}
+
+func (pool *endpointPool) pick(healthy []*endpoint) *endpoint {
+	switch pool.policy {
+	case beans.EndpointPolicyRoundRobin:
+		selected := healthy[pool.next%len(healthy)]
+		pool.next++
+		return selected
+	case beans.EndpointPolicyLowestLatency:
+		best := healthy[0]
+		for _, candidate := range healthy[1:] {
+			// 还没有耗时数据的地址优先，用于获取耗时
+			if candidate.latency < best.latency {
+				best = candidate
+			}
+		}
+		return best
+	default:
+		return healthy[0]
+	}
+}
+
+// 记录请求结果，failed 为 true 表示网络错误、超时或者服务端错误，为 false 表示请求成功
+func (pool *endpointPool) report(url string, latency time.Duration, failed bool) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	for _, target := range pool.endpoints {
+		if target.url != url {
+			continue
+		}
+		if failed {
+			target.consecutiveFailures++
+			// 探测失败或者连续失败次数达到阈值时摘除
+			if target.probing || target.consecutiveFailures >= pool.threshold {
+				target.ejectedUntil = time.Now().Add(pool.ejection)
+				target.probing = false
+			}
+			return
+		}
+		target.consecutiveFailures = 0
+		target.ejectedUntil = time.Time{}
+		target.probing = false
+		if target.latency == 0 {
+			target.latency = latency
+		} else {
+			target.latency = time.Duration(endpointLatencyWeight*float64(latency) + (1-endpointLatencyWeight)*float64(target.latency))
+		}
+		return
+	}
+}
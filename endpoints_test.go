@@ -0,0 +1,237 @@
+package sensorsabtest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+func testEndpointPool(policy beans.EndpointPolicy, ejection time.Duration) *endpointPool {
+	return newEndpointPool(beans.ABTestConfig{
+		APIUrl: "a",
+		EndpointParam: beans.EndpointParam{
+			URLs:                 []string{"b", "c"},
+			Policy:               policy,
+			FailureThreshold:     2,
+			EjectionMilliSeconds: int(ejection / time.Millisecond),
+		},
+	})
+}
+
+func chooseURL(t *testing.T, pool *endpointPool, tried map[string]bool) string {
+	t.Helper()
+	url, ok := pool.choose(tried)
+	if !ok {
+		t.Fatal("no endpoint chosen")
+	}
+	return url
+}
+
+// 地址没有被摘除并且没有在探测
+func endpointHealthy(pool *endpointPool, url string) bool {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	for _, target := range pool.endpoints {
+		if target.url == url {
+			return target.ejectedUntil.IsZero() && !target.probing
+		}
+	}
+	return false
+}
+
+func TestEndpointPoolRoundRobinStartsAtFirst(t *testing.T) {
+	pool := testEndpointPool(beans.EndpointPolicyRoundRobin, time.Minute)
+	var order []string
+	for i := 0; i < 4; i++ {
+		order = append(order, chooseURL(t, pool, nil))
+	}
+	if got := order[0] + order[1] + order[2] + order[3]; got != "abca" {
+		t.Fatalf("round robin order = %v", order)
+	}
+}
+
+func TestEndpointPoolEjectsAndRecovers(t *testing.T) {
+	pool := testEndpointPool(beans.EndpointPolicyFailover, 50*time.Millisecond)
+
+	// 连续失败次数达到阈值后摘除
+	pool.report("a", 0, true)
+	if url := chooseURL(t, pool, nil); url != "a" {
+		t.Fatalf("a should stay healthy below the threshold, got %s", url)
+	}
+	pool.report("a", 0, true)
+	if url := chooseURL(t, pool, nil); url != "b" {
+		t.Fatalf("expected failover to b, got %s", url)
+	}
+
+	// 摘除到期后仍然优先选择健康的地址，由 startProbe 放行一个探测
+	time.Sleep(60 * time.Millisecond)
+	if url := chooseURL(t, pool, nil); url != "b" {
+		t.Fatalf("expired endpoint should not be probed on the request path, got %s", url)
+	}
+	if url, ok := pool.startProbe(); !ok || url != "a" {
+		t.Fatalf("startProbe = %s, %v", url, ok)
+	}
+	if _, ok := pool.startProbe(); ok {
+		t.Fatal("only one probe should be in flight")
+	}
+
+	// 探测失败后重新摘除
+	pool.report("a", 0, true)
+	if _, ok := pool.startProbe(); ok {
+		t.Fatal("failed probe should eject the endpoint again")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if url, ok := pool.startProbe(); !ok || url != "a" {
+		t.Fatalf("startProbe = %s, %v", url, ok)
+	}
+	pool.report("a", time.Millisecond, false)
+	if url := chooseURL(t, pool, nil); url != "a" {
+		t.Fatalf("recovered endpoint should be chosen, got %s", url)
+	}
+}
+
+func TestEndpointPoolProbesWhenNoneHealthy(t *testing.T) {
+	pool := testEndpointPool(beans.EndpointPolicyFailover, 50*time.Millisecond)
+	for _, url := range []string{"a", "b", "c"} {
+		pool.report(url, 0, true)
+		pool.report(url, 0, true)
+	}
+	// 所有地址都被摘除并且没有到期时返回最早到期的地址
+	if url := chooseURL(t, pool, nil); url != "a" {
+		t.Fatalf("expected earliest ejected endpoint a, got %s", url)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if url := chooseURL(t, pool, nil); url != "a" {
+		t.Fatalf("expected probe of a, got %s", url)
+	}
+	if url := chooseURL(t, pool, map[string]bool{"a": true}); url != "b" {
+		t.Fatalf("expected probe of b, got %s", url)
+	}
+	pool.cancelProbe("b")
+	if url, ok := pool.startProbe(); !ok || url != "b" {
+		t.Fatalf("cancelled probe should be available again, got %s, %v", url, ok)
+	}
+}
+
+func TestEndpointRecoversThroughBackgroundProbe(t *testing.T) {
+	var primaryDown int32 = 1
+	var primaryRequests int32
+	primary := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&primaryRequests, 1)
+		if atomic.LoadInt32(&primaryDown) == 1 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(`{"status":"SUCCESS","results":[]}`))
+	}))
+	defer primary.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(`{"status":"SUCCESS","results":[]}`))
+	}))
+	defer backup.Close()
+
+	sensors, err := New(primary.URL, WithEndpoints(beans.EndpointParam{
+		URLs:                 []string{backup.URL},
+		FailureThreshold:     1,
+		EjectionMilliSeconds: 50,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = sensors.Shutdown(context.Background()) }()
+	params := map[string]interface{}{"login_id": "probe_user"}
+	request := func() {
+		t.Helper()
+		if _, _, err := requestExperimentFromNetwork(context.Background(), sensors, params, 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 主地址失败后切换到备用地址，并被摘除
+	request()
+	atomic.StoreInt32(&primaryDown, 0)
+	request()
+	if count := atomic.LoadInt32(&primaryRequests); count != 1 {
+		t.Fatalf("ejected primary should not be requested, got %d requests", count)
+	}
+
+	// 摘除到期后，请求仍然发往备用地址，主地址在后台探测
+	time.Sleep(60 * time.Millisecond)
+	request()
+	deadline := time.Now().Add(time.Second)
+	for !endpointHealthy(sensors.getEndpoints(), primary.URL) {
+		if time.Now().After(deadline) {
+			t.Fatal("primary did not recover")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if url := chooseEndpoint(sensors.getConfig(), sensors.getEndpoints(), nil); url != primary.URL {
+		t.Fatalf("expected recovered primary, got %s", url)
+	}
+}
+
+func TestNonRetryableErrorKeepsEndpointHealth(t *testing.T) {
+	var status int32 = http.StatusServiceUnavailable
+	primary := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer primary.Close()
+	sensors, err := New(primary.URL, WithEndpoints(beans.EndpointParam{
+		URLs:                 []string{"http://127.0.0.1:1"},
+		FailureThreshold:     2,
+		EjectionMilliSeconds: 50,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = sensors.Shutdown(context.Background()) }()
+	config := sensors.getConfig()
+	params := map[string]interface{}{"login_id": "health_user"}
+	request := func(code int32) attemptResult {
+		atomic.StoreInt32(&status, code)
+		return requestEndpoint(context.Background(), sensors, config, primary.URL, params, time.Second)
+	}
+
+	// 400 不重置之前的失败次数，第二次 503 后摘除
+	request(http.StatusServiceUnavailable)
+	if result := request(http.StatusBadRequest); result.err == nil || result.retryable {
+		t.Fatalf("expected a non-retryable error, got %v", result.err)
+	}
+	if !endpointHealthy(sensors.getEndpoints(), primary.URL) {
+		t.Fatal("a non-retryable error should not eject the endpoint")
+	}
+	request(http.StatusServiceUnavailable)
+	if endpointHealthy(sensors.getEndpoints(), primary.URL) {
+		t.Fatal("failures around a non-retryable error should eject the endpoint")
+	}
+
+	// 探测得到不可重试的错误时保持摘除，之后可以重新探测
+	time.Sleep(60 * time.Millisecond)
+	atomic.StoreInt32(&status, http.StatusBadRequest)
+	probeEndpoint(sensors, config, params, time.Second)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if url, ok := sensors.getEndpoints().startProbe(); ok {
+			if url != primary.URL {
+				t.Fatalf("startProbe = %s", url)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("probe with a non-retryable error was not finished")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	sensors.getEndpoints().cancelProbe(primary.URL)
+	if endpointHealthy(sensors.getEndpoints(), primary.URL) {
+		t.Fatal("a non-retryable probe result should not recover the endpoint")
+	}
+}
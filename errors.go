@@ -0,0 +1,55 @@
+package sensorsabtest
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DumpExpiredError 表示 LoadAllExperiments 传入的序列化数据已超过 LoadDumpedParam.MaxAge
+type DumpExpiredError struct {
+	// 序列化数据中的请求时间戳，单位 ms
+	Timestamp int64
+	// 序列化数据的实际时长，时间戳晚于当前时间时为负数
+	Age time.Duration
+	// 允许的最大时长
+	MaxAge time.Duration
+}
+
+func (e *DumpExpiredError) Error() string {
+	if e.Age < 0 {
+		return fmt.Sprintf("dumped data is from the future: timestamp %d is %v ahead of local clock", e.Timestamp, -e.Age)
+	}
+	return fmt.Sprintf("dumped data expired: age %v exceeds max age %v", e.Age, e.MaxAge)
+}
+
+// ErrShutdown 表示 SensorsABTest 已经调用过 Shutdown，不再接受新的请求
+var ErrShutdown = errors.New("SensorsABTest has been shut down")
+
+// ConfigError 表示 New 的某个配置项不合法
+type ConfigError struct {
+	// 配置项名称
+	Field string
+	// 配置项的值
+	Value interface{}
+	// 不合法的原因
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid config %s=%v: %s", e.Field, e.Value, e.Reason)
+}
+
+// EndpointError 记录请求失败时使用的分流接口地址
+type EndpointError struct {
+	Endpoint string
+	Err      error
+}
+
+func (e *EndpointError) Error() string {
+	return fmt.Sprintf("request to %s failed: %v", e.Endpoint, e.Err)
+}
+
+func (e *EndpointError) Unwrap() error {
+	return e.Err
+}
@@ -18,7 +18,9 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	sensorsabtest "github.com/sensorsdata/abtesting-sdk-go"
 	"github.com/sensorsdata/abtesting-sdk-go/beans"
@@ -44,6 +46,12 @@ func main() {
 	if err != nil {
 		fmt.Println(err)
 	}
+	// 退出前等待正在进行的请求结束，并刷新埋点事件
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = sensorsAB.Shutdown(ctx)
+	}()
 	requestPara := beans.RequestParam{
 		ParamName:              "o",
 		DefaultValue:           "{\"a\":\"Hello\",\"b\":\"World\"}",
@@ -157,6 +165,12 @@ func demoSerializeForTransfer(sensorsAB sensorsabtest.SensorsABTest) {
 	fmt.Printf("序列化成功，数据长度: %d 字符\n", len(serializedData))
 	fmt.Printf("序列化数据示例（前150字符）: %.150s...\n", serializedData)
 
+	// 放在 Header、Cookie 或 URL 中传递时，推荐使用压缩后的 base64url 格式，LoadAllExperiments 会自动识别
+	compressedData, err := result.DumpWithFormat(beans.DumpFormatGzip)
+	if err == nil {
+		fmt.Printf("压缩序列化成功，数据长度: %d 字符\n", len(compressedData))
+	}
+
 	// 模拟跨服务传递序列化数据
 	fmt.Println("\n 模拟将序列化数据传递给其他服务...")
 
@@ -1,12 +1,15 @@
 package sensorsabtest
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/sensorsdata/abtesting-sdk-go/beans"
 	"github.com/sensorsdata/abtesting-sdk-go/utils"
 	"github.com/sensorsdata/abtesting-sdk-go/utils/lru"
+	sensorsanalytics "github.com/sensorsdata/sa-sdk-go"
 )
 
 // 插件版本号标记位
@@ -14,22 +17,26 @@ var isFirstEvent = true
 
 // 埋点事件上次触发的时间
 var lastTimeEvent string
+var pluginVersionLock = sync.Mutex{}
 
-// 埋点配置
+// 埋点配置，保存最近一次网络响应中的 track_config，命中缓存时使用
 var trackConfig beans.TrackConfig
+var trackConfigLock = sync.RWMutex{}
+
+// 发送 $ABTestTrigger 事件，测试中替换为记录事件
+var trackEvent = func(sa sensorsanalytics.SensorsAnalytics, distinctId string, properties map[string]interface{}, isLoginId bool) error {
+	return sa.Track(distinctId, "$ABTestTrigger", properties, isLoginId)
+}
 
 func loadExperimentFromNetwork(sensors *SensorsABTest, distinctId string, isLoginId bool, requestParam beans.RequestParam, isTrack bool) (error, beans.Experiment) {
-	if requestParam.TimeoutMilliseconds <= 0 {
-		requestParam.TimeoutMilliseconds = 3 * 1000
-	}
 	params := buildRequestParam(distinctId, isLoginId, requestParam)
-	response, _, err := requestExperimentFromNetwork(sensors, params, int64(requestParam.TimeoutMilliseconds))
+	response, _, err := requestExperimentFromNetwork(context.Background(), sensors, params, int64(requestParam.TimeoutMilliseconds))
 	if err != nil {
 		return err, beans.Experiment{
 			Result: requestParam.DefaultValue,
 		}
 	}
-	trackConfig = response.TrackConfig
+	setTrackConfig(response.TrackConfig)
 	experiment := beans.Experiment{}
 	// 从 result 中查找
 	innerExperiment := filterExperiment(requestParam, response.Results)
@@ -74,7 +81,7 @@ func loadExperimentFromCache(sensors *SensorsABTest, distinctId string, isLoginI
 	var innerExperiment beans.InnerExperiment
 	var isRequestNetwork = false
 	idKey := getExperimentUserKey(distinctId, requestParam.CustomIDs, isLoginId)
-	if isExperimentExpired(idKey, sensors.config.ExperimentCacheTime) {
+	if isExperimentExpired(idKey, sensors.getConfig().ExperimentCacheTime) {
 		idKey := getExperimentUserKey(distinctId, requestParam.CustomIDs, isLoginId)
 		// 进行清理缓存
 		experimentCache.Remove(idKey)
@@ -89,16 +96,18 @@ func loadExperimentFromCache(sensors *SensorsABTest, distinctId string, isLoginI
 		}
 	}
 	var outExperiments []beans.InnerExperiment
+	var currentTrackConfig beans.TrackConfig
 	if isRequestNetwork {
 		// 从网络请求试验
 		params := buildRequestParam(distinctId, isLoginId, requestParam)
-		response, _, err := requestExperimentFromNetwork(sensors, params, int64(requestParam.TimeoutMilliseconds))
+		response, _, err := requestExperimentFromNetwork(context.Background(), sensors, params, int64(requestParam.TimeoutMilliseconds))
 		if err != nil {
 			return err, beans.Experiment{
 				Result: requestParam.DefaultValue,
 			}
 		}
-		trackConfig = response.TrackConfig
+		setTrackConfig(response.TrackConfig)
+		currentTrackConfig = response.TrackConfig
 		// 缓存试验
 		saveExperiment2Cache(idKey, response.Results)
 		// 筛选试验
@@ -106,6 +115,8 @@ func loadExperimentFromCache(sensors *SensorsABTest, distinctId string, isLoginI
 
 		// 从 out_list 中查找
 		outExperiments = filterOutList(requestParam, response.OutList)
+	} else {
+		currentTrackConfig = getTrackConfig()
 	}
 
 	experiment := beans.Experiment{
@@ -116,7 +127,7 @@ func loadExperimentFromCache(sensors *SensorsABTest, distinctId string, isLoginI
 	}
 	if innerExperiment.AbtestExperimentId != "" {
 		if isTrack {
-			trackABTestEvent(distinctId, isLoginId, innerExperiment, sensors, nil, requestParam.CustomIDs, trackConfig)
+			trackABTestEvent(distinctId, isLoginId, innerExperiment, sensors, nil, requestParam.CustomIDs, currentTrackConfig)
 		}
 		// 回调试验变量给客户
 		tempExperiment := beans.Experiment{
@@ -132,19 +143,35 @@ func loadExperimentFromCache(sensors *SensorsABTest, distinctId string, isLoginI
 	for _, outExperiment := range outExperiments {
 		if outExperiment.AbtestExperimentId != "" {
 			if isTrack {
-				trackABTestEvent(distinctId, isLoginId, outExperiment, sensors, nil, requestParam.CustomIDs, trackConfig)
+				trackABTestEvent(distinctId, isLoginId, outExperiment, sensors, nil, requestParam.CustomIDs, currentTrackConfig)
 			}
 		}
 	}
 	return nil, experiment
 }
 
+func getTrackConfig() beans.TrackConfig {
+	trackConfigLock.RLock()
+	defer trackConfigLock.RUnlock()
+	return trackConfig
+}
+
+func setTrackConfig(config beans.TrackConfig) {
+	trackConfigLock.Lock()
+	defer trackConfigLock.Unlock()
+	trackConfig = config
+}
+
 func trackABTestEventOuter(distinctId string, isLoginId bool, experiment beans.Experiment, sensors *SensorsABTest, properties map[string]interface{}, customIDs map[string]string) {
-	trackABTestEvent(distinctId, isLoginId, experiment.InternalExperiment, sensors, properties, customIDs, trackConfig)
+	trackABTestEvent(distinctId, isLoginId, experiment.InternalExperiment, sensors, properties, customIDs, getTrackConfig())
 }
 
 func trackABTestEvent(distinctId string, isLoginId bool, innerExperiment beans.InnerExperiment, sensors *SensorsABTest, properties map[string]interface{}, customIDs map[string]string, config beans.TrackConfig) {
-	if sensors == nil || sensors.config.SensorsAnalytics.C == nil {
+	if sensors == nil {
+		return
+	}
+	sensorsConfig := sensors.getConfig()
+	if sensorsConfig.SensorsAnalytics.C == nil {
 		return
 	}
 	// 是白名单，则不触发 $ABTestTrigger 事件
@@ -160,7 +187,7 @@ func trackABTestEvent(distinctId string, isLoginId bool, innerExperiment beans.I
 	idEvent := getEventKey(distinctId, customIDs, innerExperiment)
 	if isNewSaas && innerExperiment.Cacheable || !isNewSaas {
 		// 如果在缓存中，则不触发 $ABTestTrigger 事件
-		ok := isEventNotExistOrExpired(idEvent, innerExperiment, sensors.config.EventCacheTime)
+		ok := isEventNotExistOrExpired(idEvent, innerExperiment, sensorsConfig.EventCacheTime)
 		if !ok {
 			return
 		}
@@ -190,15 +217,17 @@ func trackABTestEvent(distinctId string, isLoginId bool, innerExperiment beans.I
 	}
 
 	currentTime := time.Now().Format("2006-01-02")
+	pluginVersionLock.Lock()
 	if isFirstEvent || currentTime != lastTimeEvent {
 		properties["$lib_plugin_version"] = []string{"golang_abtesting:" + SDK_VERSION}
 		isFirstEvent = false
 		lastTimeEvent = currentTime
 	}
+	pluginVersionLock.Unlock()
 	if innerExperiment.SubjectName == "DEVICE" {
 		properties["anonymous_id"] = innerExperiment.SubjectId
 	}
-	err := sensors.sensorsAnalytics.Track(distinctId, "$ABTestTrigger", properties, isLoginId)
+	err := trackEvent(sensorsConfig.SensorsAnalytics, distinctId, properties, isLoginId)
 	if err != nil {
 		fmt.Println("$ABTestTrigger track failed, error : ", err)
 	}
@@ -215,14 +244,81 @@ func initCache(config beans.ABTestConfig) {
 		experimentCache = lru.New(config.ExperimentCacheSize)
 		userExperimentTime = lru.New(config.ExperimentCacheSize)
 		userExperimentsCache = lru.New(config.ExperimentCacheSize)
+		experimentVersionLock.Lock()
+		experimentVersions = lru.New(config.ExperimentCacheSize)
+		experimentVersionLock.Unlock()
 	}
 }
 
-// 统一的网络请求函数
-func requestExperimentFromNetwork(sensors *SensorsABTest, requestParams map[string]interface{}, timeoutMs int64) (utils.Response, string, error) {
+// 调整缓存大小，保留已有的缓存，超出的部分按照 LRU 淘汰
+func resizeCache(config beans.ABTestConfig) {
+	eventsLock.Lock()
+	eventsTime.Resize(config.EventCacheSize)
+	hitExperiments.Resize(config.EventCacheSize)
+	eventsLock.Unlock()
+
+	experimentLock.Lock()
+	experimentCache.Resize(config.ExperimentCacheSize)
+	userExperimentTime.Resize(config.ExperimentCacheSize)
+	userExperimentsCache.Resize(config.ExperimentCacheSize)
+	experimentLock.Unlock()
+
+	experimentVersionLock.Lock()
+	experimentVersions.Resize(config.ExperimentCacheSize)
+	experimentVersionLock.Unlock()
+}
+
+// 统一的网络请求函数，ctx 结束时取消正在进行的请求
+func requestExperimentFromNetwork(ctx context.Context, sensors *SensorsABTest, requestParams map[string]interface{}, timeoutMs int64) (utils.Response, string, error) {
+	config := sensors.getConfig()
+	if timeoutMs <= 0 {
+		timeoutMs = int64(config.RequestTimeoutMilliseconds)
+	}
 	if timeoutMs <= 0 {
 		timeoutMs = 3 * 1000
 	}
 
-	return utils.RequestExperiment(sensors.config.APIUrl, requestParams, time.Duration(timeoutMs)*time.Millisecond, sensors.config.EnableRecordRequestCostTime)
+	err := sensors.lifecycle.acquire()
+	if err != nil {
+		return utils.Response{}, "", err
+	}
+	defer sensors.lifecycle.release()
+
+	var result attemptResult
+	endpoints := sensors.getEndpoints()
+	// 本次调用中已经失败的地址，所有地址都失败后才按照 RetryParam 等待重试
+	tried := make(map[string]bool)
+	backoff := retryBackoff(config.RetryParam)
+	// 切换地址和重试的总耗时不超过超时时间，每次请求使用剩余的时间
+	deadline := time.Now().Add(time.Duration(timeoutMs) * time.Millisecond)
+	for attempt := 0; ; {
+		result = requestWithHedging(ctx, sensors, config, tried, requestParams, time.Until(deadline))
+		if !result.retryable || ctx.Err() != nil || time.Until(deadline) <= 0 {
+			break
+		}
+
+		for _, url := range result.urls {
+			tried[url] = true
+		}
+		if len(tried) < endpoints.size() {
+			// 立即切换到其他地址
+			continue
+		}
+		if attempt >= config.RetryParam.MaxRetries {
+			break
+		}
+		attempt++
+		tried = make(map[string]bool)
+		// 剩余时间不足以等待重试，或者等待时 ctx 结束、SDK 关闭时返回最后一次的错误
+		if backoff >= time.Until(deadline) || !waitRetryBackoff(ctx, sensors.lifecycle, backoff) {
+			break
+		}
+		backoff = nextRetryBackoff(backoff)
+	}
+	if result.err == nil {
+		// 记录最新的试验版本，旧版本的缓存随之失效
+		observeExperimentVersions(sensors, result.response.Results, result.response.OutList)
+		probeEndpoint(sensors, config, requestParams, time.Duration(timeoutMs)*time.Millisecond)
+	}
+	return result.response, result.rawResponseBody, result.err
 }
@@ -69,17 +69,17 @@ func filterOutList(requestParam beans.RequestParam, experiments []beans.InnerExp
 }
 
 // 从缓存读取 $ABTestTrigger
-func isEventNotExistOrExpired(idEvent string, innerExperiment beans.InnerExperiment, timeout time.Duration) bool {
+func isEventNotExistOrExpired(idEvent eventKey, innerExperiment beans.InnerExperiment, timeout time.Duration) bool {
 	eventsLock.Lock()
 	defer eventsLock.Unlock()
 	lastTime, ok := eventsTime.Get(idEvent)
 	if ok {
-		expired := (utils2.NowMs() - lastTime.(int64)) > int64(timeout*time.Minute/time.Millisecond)
+		expired := (utils2.NowMs() - lastTime.(int64)) > int64(timeout/time.Millisecond)
 		if !expired {
 			// 如果未过期，则判断 abtest_experiment_result_id 是否相同
-			hitExperimentResultId, err := hitExperiments.Get(idEvent)
+			hitExperiment, err := hitExperiments.Get(idEvent)
 			if err {
-				return hitExperimentResultId.(string) != innerExperiment.AbtestExperimentResultId
+				return hitExperiment.(beans.HitExperiment).AbtestExperimentResultId != innerExperiment.AbtestExperimentResultId
 			}
 		}
 		return expired
@@ -88,14 +88,18 @@ func isEventNotExistOrExpired(idEvent string, innerExperiment beans.InnerExperim
 }
 
 // 保存 $ABTestTrigger 到缓存中
-func saveEvent2Cache(idEvent string, innerExperiment beans.InnerExperiment, sensors *SensorsABTest) {
+func saveEvent2Cache(idEvent eventKey, innerExperiment beans.InnerExperiment, sensors *SensorsABTest) {
 	// 缓存 $ABTestTrigger 事件
-	if sensors.config.EnableEventCache {
+	if sensors.getConfig().EnableEventCache {
 		eventsLock.Lock()
 		defer eventsLock.Unlock()
 		eventsTime.Remove(idEvent)
 		eventsTime.Add(idEvent, utils2.NowMs())
-		hitExperiments.Add(idEvent, innerExperiment.AbtestExperimentResultId)
+		hitExperiments.Add(idEvent, beans.HitExperiment{
+			AbtestExperimentId:       innerExperiment.AbtestExperimentId,
+			AbtestExperimentGroupId:  innerExperiment.AbtestExperimentGroupId,
+			AbtestExperimentResultId: innerExperiment.AbtestExperimentResultId,
+		})
 	}
 }
 
@@ -139,6 +143,11 @@ func loadExperimentCache(idKey string) (interface{}, bool) {
 		tempExperiment, ok := experimentCache.Get(getExperimentKey1(userExperiment))
 		if ok {
 			innerExperiment := tempExperiment.(beans.InnerExperiment)
+			// 已经出现更新的试验版本，用户的缓存视为过期
+			if isExperimentVersionOutdated(innerExperiment) {
+				experimentCache.Remove(getExperimentKey1(userExperiment))
+				return nil, false
+			}
 			innerExperiment.Cacheable = userExperiment.Cacheable
 			innerExperiment.IsControlGroup = userExperiment.IsControlGroup
 			innerExperiment.IsWhiteList = userExperiment.IsWhiteList
@@ -213,12 +222,31 @@ func buildRequestParam(distinctId string, isLoginId bool, requestParam beans.Req
 	return params
 }
 
+// $ABTestTrigger 去重缓存的唯一标识，使用结构体避免 ID 中的 "$" 导致不同用户的标识相同
+// 新 SaaS 环境以分流主体区分用户，只设置 subjectId、subjectName 和 experimentId
+type eventKey struct {
+	subjectId    string
+	subjectName  string
+	distinctId   string
+	customIDs    string
+	experimentId string
+	groupId      string
+}
+
 // 拼接缓存唯一标识
-func getEventKey(distinctId string, customIds map[string]string, innerExperiment beans.InnerExperiment) string {
+func getEventKey(distinctId string, customIds map[string]string, innerExperiment beans.InnerExperiment) eventKey {
 	if innerExperiment.SubjectId != "" {
-		return innerExperiment.SubjectId + "$" + innerExperiment.SubjectName + "$" + innerExperiment.AbtestExperimentId
-	} else {
-		return distinctId + "$" + utils.MapToJson(customIds) + "$" + innerExperiment.AbtestExperimentId + "$" + innerExperiment.AbtestExperimentGroupId
+		return eventKey{
+			subjectId:    innerExperiment.SubjectId,
+			subjectName:  innerExperiment.SubjectName,
+			experimentId: innerExperiment.AbtestExperimentId,
+		}
+	}
+	return eventKey{
+		distinctId:   distinctId,
+		customIDs:    utils.MapToJson(customIds),
+		experimentId: innerExperiment.AbtestExperimentId,
+		groupId:      innerExperiment.AbtestExperimentGroupId,
 	}
 }
 
@@ -237,7 +265,7 @@ func getExperimentKey1(experiment beans.UserExperiment) string {
 func isExperimentExpired(idKey string, timeout time.Duration) bool {
 	lastTime, ok := userExperimentTime.Get(idKey)
 	if ok {
-		return (utils2.NowMs() - lastTime.(int64)) > int64(timeout*time.Minute/time.Millisecond)
+		return (utils2.NowMs() - lastTime.(int64)) > int64(timeout/time.Millisecond)
 	}
 	return true
 }
@@ -280,3 +308,27 @@ func castValueFromString(value string, variable beans.Variables) (interface{}, e
 		return value, nil
 	}
 }
+
+// 判断用户的试验缓存未过期，并且包含所有指定的参数
+func isUserExperimentsCached(idKey string, paramNames []string, timeout time.Duration) bool {
+	if isExperimentExpired(idKey, timeout) {
+		return false
+	}
+	experiments, ok := loadExperimentCache(idKey)
+	if !ok {
+		return false
+	}
+
+	cachedParams := make(map[string]bool)
+	for _, experiment := range experiments.([]beans.InnerExperiment) {
+		for _, variable := range experiment.VariableList {
+			cachedParams[variable.Name] = true
+		}
+	}
+	for _, paramName := range paramNames {
+		if !cachedParams[paramName] {
+			return false
+		}
+	}
+	return true
+}
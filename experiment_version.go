@@ -0,0 +1,76 @@
+package sensorsabtest
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+	"github.com/sensorsdata/abtesting-sdk-go/utils/lru"
+)
+
+/*
+每个试验最新的版本号，与试验缓存一样在所有 SensorsABTest 之间共享，并按照 ExperimentCacheSize 淘汰最久未出现的试验
+版本变化时只回调观察到新版本的 SensorsABTest 的 OnExperimentVersionChange
+*/
+var experimentVersions = lru.New(4096)
+var experimentVersionLock = sync.Mutex{}
+
+// 记录网络响应中的试验版本，版本变化时回调 OnExperimentVersionChange
+func observeExperimentVersions(sensors *SensorsABTest, experimentLists ...[]beans.InnerExperiment) {
+	type versionChange struct {
+		experimentId string
+		oldVersion   string
+		newVersion   string
+	}
+	var changes []versionChange
+
+	experimentVersionLock.Lock()
+	for _, experiments := range experimentLists {
+		for _, experiment := range experiments {
+			if experiment.AbtestExperimentId == "" || experiment.AbtestExperimentVersion == "" {
+				continue
+			}
+			var oldVersion string
+			if version, ok := experimentVersions.Get(experiment.AbtestExperimentId); ok {
+				oldVersion = version.(string)
+			}
+			if !isNewerVersion(experiment.AbtestExperimentVersion, oldVersion) {
+				continue
+			}
+			experimentVersions.Add(experiment.AbtestExperimentId, experiment.AbtestExperimentVersion)
+			changes = append(changes, versionChange{experiment.AbtestExperimentId, oldVersion, experiment.AbtestExperimentVersion})
+		}
+	}
+	experimentVersionLock.Unlock()
+
+	if sensors == nil || sensors.getConfig().OnExperimentVersionChange == nil {
+		return
+	}
+	for _, change := range changes {
+		sensors.getConfig().OnExperimentVersionChange(change.experimentId, change.oldVersion, change.newVersion)
+	}
+}
+
+// 判断缓存的试验是否比已知的最新版本旧
+func isExperimentVersionOutdated(experiment beans.InnerExperiment) bool {
+	experimentVersionLock.Lock()
+	latestVersion, ok := experimentVersions.Get(experiment.AbtestExperimentId)
+	experimentVersionLock.Unlock()
+	return ok && isNewerVersion(latestVersion.(string), experiment.AbtestExperimentVersion)
+}
+
+// 版本号为整数时按数值比较，避免旧的响应覆盖新版本，否则只要不同就认为是新版本
+func isNewerVersion(version string, current string) bool {
+	if version == current {
+		return false
+	}
+	if current == "" {
+		return true
+	}
+	newValue, newErr := strconv.ParseInt(version, 10, 64)
+	currentValue, currentErr := strconv.ParseInt(current, 10, 64)
+	if newErr == nil && currentErr == nil {
+		return newValue > currentValue
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package sensorsabtest
+
+import (
+	"testing"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+func TestExperimentVersionsAreBounded(t *testing.T) {
+	var changes []string
+	sensors := &SensorsABTest{config: newSharedConfig(beans.ABTestConfig{
+		OnExperimentVersionChange: func(experimentId string, oldVersion string, newVersion string) {
+			changes = append(changes, experimentId+":"+oldVersion+"->"+newVersion)
+		},
+	})}
+	initCache(beans.ABTestConfig{ExperimentCacheSize: 2})
+
+	observeExperimentVersions(sensors, []beans.InnerExperiment{
+		{AbtestExperimentId: "a", AbtestExperimentVersion: "1"},
+		{AbtestExperimentId: "b", AbtestExperimentVersion: "1"},
+	})
+	observeExperimentVersions(sensors, []beans.InnerExperiment{{AbtestExperimentId: "a", AbtestExperimentVersion: "2"}})
+	// 旧版本的响应不会覆盖新版本
+	observeExperimentVersions(sensors, []beans.InnerExperiment{{AbtestExperimentId: "a", AbtestExperimentVersion: "1"}})
+	if !isExperimentVersionOutdated(beans.InnerExperiment{AbtestExperimentId: "a", AbtestExperimentVersion: "1"}) {
+		t.Fatal("version 1 of a should be outdated")
+	}
+
+	// 超过 ExperimentCacheSize 时淘汰最久未出现的试验 b
+	observeExperimentVersions(nil, []beans.InnerExperiment{{AbtestExperimentId: "c", AbtestExperimentVersion: "1"}})
+	if experimentVersions.Len() != 2 {
+		t.Fatalf("expected 2 tracked experiments, got %d", experimentVersions.Len())
+	}
+	if _, ok := experimentVersions.Get("b"); ok {
+		t.Fatal("b should be evicted")
+	}
+
+	want := []string{"a:->1", "b:->1", "a:1->2"}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %v", changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("changes = %v", changes)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package sensorsabtest
+
+import (
+	"sync"
+
+	sensorsanalytics "github.com/sensorsdata/sa-sdk-go"
+)
+
+// TrackedEvent 是测试中记录的 $ABTestTrigger 事件
+type TrackedEvent struct {
+	DistinctId string
+	IsLoginId  bool
+	Properties map[string]interface{}
+}
+
+// RecordTrackedEvents 替换 $ABTestTrigger 的发送函数，返回读取已记录事件的函数，cleanup 用于在测试结束后恢复
+func RecordTrackedEvents(cleanup func(func())) func() []TrackedEvent {
+	var lock sync.Mutex
+	var events []TrackedEvent
+	original := trackEvent
+	trackEvent = func(sa sensorsanalytics.SensorsAnalytics, distinctId string, properties map[string]interface{}, isLoginId bool) error {
+		lock.Lock()
+		defer lock.Unlock()
+		events = append(events, TrackedEvent{DistinctId: distinctId, IsLoginId: isLoginId, Properties: properties})
+		return nil
+	}
+	cleanup(func() { trackEvent = original })
+	return func() []TrackedEvent {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]TrackedEvent(nil), events...)
+	}
+}
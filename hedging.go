@@ -0,0 +1,231 @@
+package sensorsabtest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+	"github.com/sensorsdata/abtesting-sdk-go/utils"
+)
+
+const (
+	defaultHedgingMaxPercent = 5
+	// 计算 p95 使用的最近成功请求数，以及开始对冲前至少需要的样本数
+	hedgingLatencyWindow     = 200
+	hedgingMinLatencySamples = 20
+)
+
+// 对冲请求的延迟和额度，SensorsABTest 的所有副本共享
+type hedger struct {
+	lock  sync.Mutex
+	delay time.Duration
+	// 每个请求增加 MaxPercent/100 个额度，对冲一次消耗 1 个，额度上限为 1，保证对冲比例不超过 MaxPercent
+	tokens          float64
+	tokensPerCall   float64
+	latencies       []time.Duration
+	nextLatency     int
+	p95             time.Duration
+	samplesSinceP95 int
+}
+
+// 未开启对冲时返回 nil
+func newHedger(param beans.HedgingParam) *hedger {
+	if !param.Enable {
+		return nil
+	}
+	maxPercent := param.MaxPercent
+	if maxPercent <= 0 {
+		maxPercent = defaultHedgingMaxPercent
+	}
+	return &hedger{
+		delay:         time.Duration(param.DelayMilliSeconds) * time.Millisecond,
+		tokensPerCall: float64(maxPercent) / 100,
+	}
+}
+
+// 返回发出对冲请求前的等待时间，未设置 DelayMilliSeconds 并且样本不足时不对冲
+func (h *hedger) hedgeDelay() (time.Duration, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.tokens += h.tokensPerCall
+	if h.tokens > 1 {
+		h.tokens = 1
+	}
+	if h.delay > 0 {
+		return h.delay, true
+	}
+	return h.p95, h.p95 > 0
+}
+
+// 消耗一个对冲额度
+func (h *hedger) allow() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.tokens < 1 {
+		return false
+	}
+	h.tokens--
+	return true
+}
+
+// 记录返回的结果的耗时，失败的结果不记录
+func (h *hedger) observeResult(result attemptResult) attemptResult {
+	if result.err == nil {
+		h.observe(result.latency)
+	}
+	return result
+}
+
+// 记录成功请求的耗时，用于计算 p95
+func (h *hedger) observe(latency time.Duration) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if len(h.latencies) < hedgingLatencyWindow {
+		h.latencies = append(h.latencies, latency)
+	} else {
+		h.latencies[h.nextLatency] = latency
+		h.nextLatency = (h.nextLatency + 1) % hedgingLatencyWindow
+	}
+	h.samplesSinceP95++
+	if len(h.latencies) < hedgingMinLatencySamples || (h.p95 > 0 && h.samplesSinceP95 < hedgingMinLatencySamples) {
+		return
+	}
+	sorted := append([]time.Duration(nil), h.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	h.p95 = sorted[len(sorted)*95/100]
+	h.samplesSinceP95 = 0
+}
+
+// 一次请求的结果，发生对冲时 urls 包含两个地址
+type attemptResult struct {
+	urls            []string
+	response        utils.Response
+	rawResponseBody string
+	err             error
+	retryable       bool
+	latency         time.Duration
+}
+
+// 向一个地址发送请求，并记录地址的健康状态和耗时
+// ctx 结束导致的失败不计入地址的健康状态，也不会重试
+func requestEndpoint(ctx context.Context, sensors *SensorsABTest, config beans.ABTestConfig, url string, requestParams map[string]interface{}, timeout time.Duration) attemptResult {
+	endpoints := sensors.getEndpoints()
+	startTime := time.Now()
+	response, rawResponseBody, err := utils.RequestExperimentContext(ctx, url, requestParams, timeout, requestConfig(config))
+	latency := time.Since(startTime)
+	retryable := err != nil && ctx.Err() == nil && utils.IsRetryableError(err)
+	// 只有成功才恢复地址的健康状态，不可重试的错误（例如 4xx、响应解析失败）不修改健康状态
+	if endpoints.size() > 0 && (err == nil || retryable) {
+		endpoints.report(url, latency, retryable)
+	}
+	if err != nil {
+		err = &EndpointError{Endpoint: url, Err: err}
+	}
+	return attemptResult{urls: []string{url}, response: response, rawResponseBody: rawResponseBody, err: err, retryable: retryable, latency: latency}
+}
+
+/*
+请求成功后，使用相同的请求参数在后台探测一个摘除到期的地址，探测成功后地址恢复为健康
+探测计入 lifecycle，开启录制回放时不探测，避免录制额外的请求
+*/
+func probeEndpoint(sensors *SensorsABTest, config beans.ABTestConfig, requestParams map[string]interface{}, timeout time.Duration) {
+	endpoints := sensors.getEndpoints()
+	url, ok := endpoints.startProbe()
+	if !ok {
+		return
+	}
+	if utils.IsCassetteEnabled() || sensors.lifecycle.acquire() != nil {
+		endpoints.cancelProbe(url)
+		return
+	}
+	params := make(map[string]interface{}, len(requestParams))
+	for key, value := range requestParams {
+		params[key] = value
+	}
+	go func() {
+		defer sensors.lifecycle.release()
+		result := requestEndpoint(context.Background(), sensors, config, url, params, timeout)
+		if result.err != nil && !result.retryable {
+			// 探测没有得出地址是否健康，保持摘除状态，之后重新探测
+			endpoints.cancelProbe(url)
+		}
+	}()
+}
+
+func chooseEndpoint(config beans.ABTestConfig, endpoints *endpointPool, tried map[string]bool) string {
+	if endpoints.size() > 0 {
+		if url, ok := endpoints.choose(tried); ok {
+			return url
+		}
+	}
+	return config.APIUrl
+}
+
+/*
+发送一次请求，开启对冲时如果超过等待时间仍未返回，并且对冲额度足够，向另一个未尝试过的地址发送相同的请求
+没有其他可用的地址时不对冲，使用先成功返回的结果并取消另一个请求，两个请求都失败时返回先失败的结果
+只有返回的结果计入 p95 耗时，落后的请求不计入
+*/
+func requestWithHedging(ctx context.Context, sensors *SensorsABTest, config beans.ABTestConfig, tried map[string]bool, requestParams map[string]interface{}, timeout time.Duration) attemptResult {
+	endpoints := sensors.getEndpoints()
+	url := chooseEndpoint(config, endpoints, tried)
+	deadline := time.Now().Add(timeout)
+	h := sensors.getHedger()
+	if h == nil {
+		return requestEndpoint(ctx, sensors, config, url, requestParams, timeout)
+	}
+	hedgeTried := map[string]bool{url: true}
+	for triedURL := range tried {
+		hedgeTried[triedURL] = true
+	}
+	delay, ok := h.hedgeDelay()
+	// 返回结果后落后的请求仍在进行，需要计入 lifecycle，保证 Shutdown 等待其结束
+	if !ok || len(hedgeTried) >= endpoints.size() || sensors.lifecycle.acquire() != nil {
+		return h.observeResult(requestEndpoint(ctx, sensors, config, url, requestParams, timeout))
+	}
+
+	// 每个请求使用单独的 ctx，返回结果后取消落后的请求，被取消的请求不计入地址的健康状态
+	results := make(chan attemptResult, 2)
+	primaryCtx, cancelPrimary := context.WithCancel(ctx)
+	go func() {
+		defer sensors.lifecycle.release()
+		defer cancelPrimary()
+		results <- requestEndpoint(primaryCtx, sensors, config, url, requestParams, timeout)
+	}()
+
+	timer := time.NewTimer(delay)
+	select {
+	case result := <-results:
+		timer.Stop()
+		return h.observeResult(result)
+	case <-timer.C:
+	}
+	if !h.allow() || sensors.lifecycle.acquire() != nil {
+		return h.observeResult(<-results)
+	}
+
+	hedgeURL := chooseEndpoint(config, endpoints, hedgeTried)
+	hedgeCtx, cancelHedge := context.WithCancel(ctx)
+	go func() {
+		defer sensors.lifecycle.release()
+		defer cancelHedge()
+		// 对冲请求与原请求同时超时
+		results <- requestEndpoint(hedgeCtx, sensors, config, hedgeURL, requestParams, time.Until(deadline))
+	}()
+
+	first := <-results
+	if first.err == nil {
+		cancelPrimary()
+		cancelHedge()
+		return h.observeResult(first)
+	}
+	second := <-results
+	if second.err == nil {
+		return h.observeResult(second)
+	}
+	first.urls = append(first.urls, second.urls...)
+	first.retryable = first.retryable && second.retryable
+	return first
+}
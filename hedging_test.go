@@ -0,0 +1,101 @@
+package sensorsabtest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+// 返回空结果的分流接口，记录收到的请求数
+func newLatencyServer(latency time.Duration, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(requests, 1)
+		time.Sleep(latency)
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(`{"status":"SUCCESS","results":[]}`))
+	}))
+}
+
+func TestHedgerCapsHedgePercentage(t *testing.T) {
+	for _, maxPercent := range []int{1, 5, 50} {
+		h := newHedger(beans.HedgingParam{Enable: true, DelayMilliSeconds: 1, MaxPercent: maxPercent})
+		calls := 1000
+		hedged := 0
+		for i := 0; i < calls; i++ {
+			if _, ok := h.hedgeDelay(); ok && h.allow() {
+				hedged++
+			}
+		}
+		if limit := calls*maxPercent/100 + 1; hedged > limit || hedged < limit-2 {
+			t.Fatalf("MaxPercent %d: hedged %d of %d calls, limit %d", maxPercent, hedged, calls, limit)
+		}
+	}
+}
+
+func TestHedgingSkipsWithoutOtherEndpoint(t *testing.T) {
+	var requests int32
+	server := newLatencyServer(50*time.Millisecond, &requests)
+	defer server.Close()
+	sensors, err := New(server.URL, WithHedging(beans.HedgingParam{Enable: true, DelayMilliSeconds: 5, MaxPercent: 100}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err = requestExperimentFromNetwork(context.Background(), sensors, map[string]interface{}{"login_id": "hedge_user"}, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err = sensors.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if count := atomic.LoadInt32(&requests); count != 1 {
+		t.Fatalf("expected no hedge to the same URL, got %d requests", count)
+	}
+}
+
+func TestHedgingObservesOnlyWinner(t *testing.T) {
+	var slowRequests, fastRequests int32
+	slow := newLatencyServer(200*time.Millisecond, &slowRequests)
+	defer slow.Close()
+	fast := newLatencyServer(0, &fastRequests)
+	defer fast.Close()
+	sensors, err := New(slow.URL,
+		WithEndpoints(beans.EndpointParam{URLs: []string{fast.URL}, FailureThreshold: 1}),
+		WithHedging(beans.HedgingParam{Enable: true, DelayMilliSeconds: 20, MaxPercent: 100}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	startTime := time.Now()
+	if _, _, err = requestExperimentFromNetwork(context.Background(), sensors, map[string]interface{}{"login_id": "hedge_user"}, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(startTime); elapsed >= 200*time.Millisecond {
+		t.Fatalf("hedged request took %v", elapsed)
+	}
+	// 落后的请求在返回结果后被取消，Shutdown 不需要等待其结束
+	if err = sensors.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(startTime); elapsed >= 200*time.Millisecond {
+		t.Fatalf("losing request was not cancelled, Shutdown returned after %v", elapsed)
+	}
+	// 被取消的请求不计入地址的健康状态
+	if !endpointHealthy(sensors.getEndpoints(), slow.URL) {
+		t.Fatal("cancelled request should not eject the slow endpoint")
+	}
+	if atomic.LoadInt32(&slowRequests) != 1 || atomic.LoadInt32(&fastRequests) != 1 {
+		t.Fatalf("requests: slow = %d, fast = %d", slowRequests, fastRequests)
+	}
+
+	h := sensors.getHedger()
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if len(h.latencies) != 1 || h.latencies[0] >= 200*time.Millisecond {
+		t.Fatalf("expected only the winner's latency, got %v", h.latencies)
+	}
+}
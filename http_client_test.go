@@ -0,0 +1,167 @@
+package sensorsabtest_test
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	sensorsabtest "github.com/sensorsdata/abtesting-sdk-go"
+	"github.com/sensorsdata/abtesting-sdk-go/abtesttest"
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+	"github.com/sensorsdata/abtesting-sdk-go/utils"
+)
+
+func fetchColor(t *testing.T, sensors *sensorsabtest.SensorsABTest, distinctId string) error {
+	t.Helper()
+	err, _ := sensors.AsyncFetchABTest(distinctId, true, beans.RequestParam{ParamName: "color", DefaultValue: "blue"})
+	return err
+}
+
+func TestCustomHeadersAreSent(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{
+		Results: []beans.InnerExperiment{testExperiment("exp_header", "color", "red", "STRING")},
+	})
+	defer server.Close()
+	var calls int32
+	sensors, _ := newTestSDK(t, server,
+		sensorsabtest.WithHeaders(map[string]string{"X-Team": "ab", "Authorization": "static"}),
+		sensorsabtest.WithHeaderProvider(func() (map[string]string, error) {
+			return map[string]string{"Authorization": fmt.Sprintf("Bearer %d", atomic.AddInt32(&calls, 1))}, nil
+		}))
+
+	for i := 0; i < 2; i++ {
+		if err := fetchColor(t, sensors, "header_user"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	requests := server.Requests()
+	if len(requests) != 2 || atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("requests = %d, provider calls = %d", len(requests), calls)
+	}
+	for i, request := range requests {
+		if request.Header.Get("X-Team") != "ab" {
+			t.Fatalf("request %d: X-Team = %q", i, request.Header.Get("X-Team"))
+		}
+		// HeaderProvider 每次请求都会调用，并覆盖同名的静态 Header
+		if want := fmt.Sprintf("Bearer %d", i+1); request.Header.Get("Authorization") != want {
+			t.Fatalf("request %d: Authorization = %q, want %q", i, request.Header.Get("Authorization"), want)
+		}
+	}
+}
+
+func TestHeaderProviderErrorStopsRequest(t *testing.T) {
+	server := abtesttest.NewServer()
+	defer server.Close()
+	providerErr := errors.New("token unavailable")
+	sensors, _ := newTestSDK(t, server, sensorsabtest.WithHeaderProvider(func() (map[string]string, error) {
+		return nil, providerErr
+	}))
+
+	if err := fetchColor(t, sensors, "header_user"); !errors.Is(err, providerErr) {
+		t.Fatalf("expected provider error, got %v", err)
+	}
+	if len(server.Requests()) != 0 {
+		t.Fatalf("request should not be sent, got %d", len(server.Requests()))
+	}
+}
+
+func TestHTTPClientSettingsArePerInstance(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{
+		Results: []beans.InnerExperiment{testExperiment("exp_header", "color", "red", "STRING")},
+	})
+	defer server.Close()
+	first, _ := newTestSDK(t, server, sensorsabtest.WithHeaders(map[string]string{"X-Tenant": "first"}))
+	// 后创建的实例不会替换先创建的实例的 Header
+	second, _ := newTestSDK(t, server, sensorsabtest.WithHeaders(map[string]string{"X-Tenant": "second", "X-Second": "1"}))
+
+	if err := fetchColor(t, first, "first_user"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fetchColor(t, second, "second_user"); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.UpdateConfig(sensorsabtest.WithHeaders(map[string]string{"X-Tenant": "first_v2"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := fetchColor(t, second, "second_user"); err != nil {
+		t.Fatal(err)
+	}
+
+	var tenants []string
+	for _, request := range server.Requests() {
+		tenants = append(tenants, request.DistinctId+":"+request.Header.Get("X-Tenant")+":"+request.Header.Get("X-Second"))
+	}
+	want := "first_user:first: second_user:second:1 second_user:second:1"
+	if got := fmt.Sprint(tenants); got != "["+want+"]" {
+		t.Fatalf("tenants = %v, want [%s]", tenants, want)
+	}
+}
+
+func TestRequestSignerIsPerInstance(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{
+		Results: []beans.InnerExperiment{testExperiment("exp_signer", "color", "red", "STRING")},
+	})
+	defer server.Close()
+	newSigner := func(keyId string) beans.RequestSigner {
+		signer, err := utils.NewHMACSigner(keyId, []byte(keyId+"_secret"), utils.HMACHeaderLayout{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signer
+	}
+	first, _ := newTestSDK(t, server, sensorsabtest.WithRequestSigner(newSigner("first_key")))
+	// 后创建的实例使用自己的密钥，不影响先创建的实例
+	second, _ := newTestSDK(t, server, sensorsabtest.WithRequestSigner(newSigner("second_key")))
+
+	if err := fetchColor(t, first, "first_user"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fetchColor(t, second, "second_user"); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, request := range server.Requests() {
+		if request.Header.Get("X-AB-Signature") == "" {
+			t.Fatalf("request of %s is not signed", request.DistinctId)
+		}
+		keys = append(keys, request.DistinctId+":"+request.Header.Get("X-AB-Key-Id"))
+	}
+	if got := fmt.Sprint(keys); got != "[first_user:first_key second_user:second_key]" {
+		t.Fatalf("key ids = %s", got)
+	}
+}
+
+func TestRequestObserverIsPerInstance(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{
+		Results: []beans.InnerExperiment{testExperiment("exp_observer", "color", "red", "STRING")},
+	})
+	defer server.Close()
+	var firstCount, secondCount int32
+	first, _ := newTestSDK(t, server,
+		sensorsabtest.WithCompression(beans.CompressionParam{EnableRequestGzip: true, RequestGzipMinBytes: 1}),
+		sensorsabtest.WithRequestObserver(func(observation beans.RequestObservation) { atomic.AddInt32(&firstCount, 1) }))
+	second, _ := newTestSDK(t, server,
+		sensorsabtest.WithRequestObserver(func(observation beans.RequestObservation) { atomic.AddInt32(&secondCount, 1) }))
+
+	if err := fetchColor(t, first, "first_user"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fetchColor(t, second, "second_user"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fetchColor(t, second, "second_user_2"); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&firstCount) != 1 || atomic.LoadInt32(&secondCount) != 2 {
+		t.Fatalf("observations: first = %d, second = %d", firstCount, secondCount)
+	}
+	// 只有开启压缩的实例压缩请求体
+	var encodings []string
+	for _, request := range server.Requests() {
+		encodings = append(encodings, request.DistinctId+":"+request.Header.Get("Content-Encoding"))
+	}
+	if got := fmt.Sprint(encodings); got != "[first_user:gzip second_user: second_user_2:]" {
+		t.Fatalf("encodings = %s", got)
+	}
+}
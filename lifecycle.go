@@ -0,0 +1,94 @@
+package sensorsabtest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sensorsdata/abtesting-sdk-go/utils"
+)
+
+// 记录正在进行的网络请求，SensorsABTest 按值传递，所有副本共享同一个 lifecycle
+type lifecycle struct {
+	lock     sync.Mutex
+	shutdown bool
+	inFlight sync.WaitGroup
+	// Shutdown 时关闭，用于中断重试等待
+	done chan struct{}
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{done: make(chan struct{})}
+}
+
+// 开始一个请求，已经关闭时返回 ErrShutdown
+func (l *lifecycle) acquire() error {
+	if l == nil {
+		return nil
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.shutdown {
+		return ErrShutdown
+	}
+	l.inFlight.Add(1)
+	return nil
+}
+
+func (l *lifecycle) release() {
+	if l == nil {
+		return
+	}
+	l.inFlight.Done()
+}
+
+// 返回 Shutdown 时关闭的 channel，lifecycle 为 nil 时返回的 channel 永远不会关闭
+func (l *lifecycle) closed() <-chan struct{} {
+	if l == nil {
+		return nil
+	}
+	return l.done
+}
+
+func (l *lifecycle) isShutdown() bool {
+	if l == nil {
+		return false
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.shutdown
+}
+
+/*
+关闭 SensorsABTest
+不再接受新的请求，中断正在等待的重试，等待正在进行的网络请求结束后，将埋点事件刷新到 SensorsAnalytics，并关闭空闲连接
+ctx 先于请求结束时返回 ctx 的错误，此时不会刷新埋点事件
+SensorsAnalytics 由调用方创建，需要由调用方自行关闭
+SDK 的 HTTP 连接池由所有 SensorsABTest 共享，关闭空闲连接后其他实例的请求会重新建立连接，不会失败
+*/
+func (sensors *SensorsABTest) Shutdown(ctx context.Context) error {
+	if sensors.lifecycle != nil {
+		sensors.lifecycle.lock.Lock()
+		if !sensors.lifecycle.shutdown {
+			sensors.lifecycle.shutdown = true
+			close(sensors.lifecycle.done)
+		}
+		sensors.lifecycle.lock.Unlock()
+
+		done := make(chan struct{})
+		go func() {
+			sensors.lifecycle.inFlight.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if sa := sensors.getConfig().SensorsAnalytics; sa.C != nil {
+		sa.Flush()
+	}
+	utils.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,82 @@
+package sensorsabtest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sensorsabtest "github.com/sensorsdata/abtesting-sdk-go"
+	"github.com/sensorsdata/abtesting-sdk-go/abtesttest"
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+// 等待 server 收到 count 个请求
+func waitForRequests(t *testing.T, server *abtesttest.Server, count int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for len(server.Requests()) < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d requests, got %d", count, len(server.Requests()))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestShutdownWaitsForInFlightRequests(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{
+		Results: []beans.InnerExperiment{testExperiment("exp_shutdown", "color", "red", "STRING")},
+		Latency: 200 * time.Millisecond,
+	})
+	defer server.Close()
+	sensors, _ := newTestSDK(t, server)
+
+	fetched := make(chan error, 1)
+	go func() {
+		err, _ := sensors.AsyncFetchABTest("shutdown_user", true, beans.RequestParam{ParamName: "color", DefaultValue: "blue"})
+		fetched <- err
+	}()
+	waitForRequests(t, server, 1)
+
+	if err := sensors.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Shutdown 返回时正在进行的请求已经结束
+	select {
+	case err := <-fetched:
+		if err != nil {
+			t.Fatalf("in-flight request failed: %v", err)
+		}
+	default:
+		t.Fatal("Shutdown returned before the in-flight request finished")
+	}
+
+	err, experiment := sensors.AsyncFetchABTest("shutdown_user", true, beans.RequestParam{ParamName: "color", DefaultValue: "blue"})
+	if !errors.Is(err, sensorsabtest.ErrShutdown) || experiment.Result != "blue" {
+		t.Fatalf("after Shutdown: %v, %v", experiment.Result, err)
+	}
+	if len(server.Requests()) != 1 {
+		t.Fatalf("expected no request after Shutdown, got %d", len(server.Requests()))
+	}
+}
+
+func TestShutdownReturnsWhenContextExpires(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{Latency: time.Second})
+	defer server.Close()
+	sensors, _ := newTestSDK(t, server)
+
+	go func() {
+		_, _ = sensors.AsyncFetchABTest("shutdown_user", true, beans.RequestParam{ParamName: "color", DefaultValue: "blue"})
+	}()
+	waitForRequests(t, server, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	startTime := time.Now()
+	if err := sensors.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(startTime); elapsed > 500*time.Millisecond {
+		t.Fatalf("Shutdown took %v after ctx expired", elapsed)
+	}
+}
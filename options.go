@@ -0,0 +1,338 @@
+package sensorsabtest
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+	sensorsanalytics "github.com/sensorsdata/sa-sdk-go"
+)
+
+const (
+	defaultCacheSize = 4096
+	defaultCacheTime = 24 * time.Hour
+	maxCacheTime     = 24 * time.Hour
+)
+
+// Option 是 New 的配置项，不合法的值会返回 ConfigError，而不是像 ABTestConfig 一样被修正为默认值
+type Option func(config *beans.ABTestConfig) error
+
+/*
+创建 SensorsABTest
+与 InitSensorsABTest 不同，缓存时间使用真实的 time.Duration，不合法的配置会返回错误
+*/
+func New(apiURL string, opts ...Option) (*SensorsABTest, error) {
+	err := validateAPIURL("APIUrl", apiURL)
+	if err != nil {
+		return nil, err
+	}
+
+	config := beans.ABTestConfig{
+		APIUrl:              apiURL,
+		ExperimentCacheTime: defaultCacheTime,
+		ExperimentCacheSize: defaultCacheSize,
+		EventCacheTime:      defaultCacheTime,
+		EventCacheSize:      defaultCacheSize,
+		// 与 InitSensorsABTest 的默认值保持一致
+		RequestTimeoutMilliseconds: 3 * 1000,
+	}
+	for _, opt := range opts {
+		err = opt(&config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	config.HTTPTransportParam = getHTTPTransPortParam(config)
+
+	err = applyConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &SensorsABTest{
+		config:    newSharedConfig(config),
+		lifecycle: newLifecycle(),
+	}, nil
+}
+
+func validateAPIURL(field string, apiURL string) error {
+	parsedURL, err := url.Parse(apiURL)
+	if apiURL == "" || err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return &ConfigError{Field: field, Value: apiURL, Reason: "must be an absolute http or https URL"}
+	}
+	return nil
+}
+
+// WithExperimentCacheTTL 设置试验缓存时间，范围 (0, 24h]，默认 24h
+func WithExperimentCacheTTL(ttl time.Duration) Option {
+	return func(config *beans.ABTestConfig) error {
+		if ttl <= 0 || ttl > maxCacheTime {
+			return &ConfigError{Field: "ExperimentCacheTTL", Value: ttl, Reason: "must be in (0, 24h]"}
+		}
+		config.ExperimentCacheTime = ttl
+		return nil
+	}
+}
+
+// WithExperimentCacheSize 设置试验缓存的用户数，默认 4096
+func WithExperimentCacheSize(size int) Option {
+	return func(config *beans.ABTestConfig) error {
+		if size <= 0 {
+			return &ConfigError{Field: "ExperimentCacheSize", Value: size, Reason: "must be positive"}
+		}
+		config.ExperimentCacheSize = size
+		return nil
+	}
+}
+
+// WithEventCacheTTL 设置 $ABTestTrigger 事件缓存时间，范围 (0, 24h]，默认 24h
+func WithEventCacheTTL(ttl time.Duration) Option {
+	return func(config *beans.ABTestConfig) error {
+		if ttl <= 0 || ttl > maxCacheTime {
+			return &ConfigError{Field: "EventCacheTTL", Value: ttl, Reason: "must be in (0, 24h]"}
+		}
+		config.EventCacheTime = ttl
+		return nil
+	}
+}
+
+// WithEventCacheSize 设置 $ABTestTrigger 事件缓存的数量，默认 4096
+func WithEventCacheSize(size int) Option {
+	return func(config *beans.ABTestConfig) error {
+		if size <= 0 {
+			return &ConfigError{Field: "EventCacheSize", Value: size, Reason: "must be positive"}
+		}
+		config.EventCacheSize = size
+		return nil
+	}
+}
+
+// WithEventCache 开启 $ABTestTrigger 事件缓存
+func WithEventCache(enable bool) Option {
+	return func(config *beans.ABTestConfig) error {
+		config.EnableEventCache = enable
+		return nil
+	}
+}
+
+// WithRequestCostTimeRecording 开启请求耗时记录
+func WithRequestCostTimeRecording(enable bool) Option {
+	return func(config *beans.ABTestConfig) error {
+		config.EnableRecordRequestCostTime = enable
+		return nil
+	}
+}
+
+// WithEndpoints 设置除 APIUrl 外的其他分流接口地址和选择策略，连续失败的地址会被暂时摘除
+func WithEndpoints(param beans.EndpointParam) Option {
+	return func(config *beans.ABTestConfig) error {
+		for _, endpointURL := range param.URLs {
+			err := validateAPIURL("EndpointParam.URLs", endpointURL)
+			if err != nil {
+				return err
+			}
+		}
+		if param.Policy.String() == "unknown" {
+			return &ConfigError{Field: "EndpointParam.Policy", Value: int(param.Policy), Reason: "unknown policy"}
+		}
+		if param.FailureThreshold < 0 {
+			return &ConfigError{Field: "EndpointParam.FailureThreshold", Value: param.FailureThreshold, Reason: "must not be negative"}
+		}
+		if param.EjectionMilliSeconds < 0 {
+			return &ConfigError{Field: "EndpointParam.EjectionMilliSeconds", Value: param.EjectionMilliSeconds, Reason: "must not be negative"}
+		}
+		config.EndpointParam = param
+		config.EndpointParam.URLs = append([]string(nil), param.URLs...)
+		return nil
+	}
+}
+
+// WithHedging 开启对冲请求，降低偶发的慢请求带来的长尾耗时
+func WithHedging(param beans.HedgingParam) Option {
+	return func(config *beans.ABTestConfig) error {
+		if param.DelayMilliSeconds < 0 {
+			return &ConfigError{Field: "HedgingParam.DelayMilliSeconds", Value: param.DelayMilliSeconds, Reason: "must not be negative"}
+		}
+		if param.MaxPercent < 0 || param.MaxPercent > 100 {
+			return &ConfigError{Field: "HedgingParam.MaxPercent", Value: param.MaxPercent, Reason: "must be in [0, 100]"}
+		}
+		config.HedgingParam = param
+		return nil
+	}
+}
+
+// WithHTTPTransport 设置 HTTP 连接参数、TLS 证书和代理，为 0 的字段使用默认值
+func WithHTTPTransport(param beans.HTTPTransportParam) Option {
+	return func(config *beans.ABTestConfig) error {
+		fields := []struct {
+			name  string
+			value int
+		}{
+			{"MaxIdleConnsPerHost", param.MaxIdleConnsPerHost},
+			{"MaxIdleConns", param.MaxIdleConns},
+			{"MaxConnsPerHost", param.MaxConnsPerHost},
+			{"IdleConnTimeoutMilliSeconds", param.IdleConnTimeoutMilliSeconds},
+			{"DialTimeoutMilliSeconds", param.DialTimeoutMilliSeconds},
+			{"DialKeepAliveMilliSeconds", param.DialKeepAliveMilliSeconds},
+		}
+		for _, field := range fields {
+			if field.value < 0 {
+				return &ConfigError{Field: "HTTPTransportParam." + field.name, Value: field.value, Reason: "must not be negative"}
+			}
+		}
+		if (param.CertFile == "") != (param.KeyFile == "") {
+			return &ConfigError{Field: "HTTPTransportParam.CertFile", Value: param.CertFile, Reason: "must be set together with KeyFile"}
+		}
+		if param.ProxyURL != "" {
+			proxyURL, err := url.Parse(param.ProxyURL)
+			if err != nil || (proxyURL.Scheme != "http" && proxyURL.Scheme != "https" && proxyURL.Scheme != "socks5") || proxyURL.Host == "" {
+				return &ConfigError{Field: "HTTPTransportParam.ProxyURL", Value: param.ProxyURL, Reason: "must be an http, https or socks5 URL"}
+			}
+		}
+		config.HTTPTransportParam = param
+		return nil
+	}
+}
+
+// WithHTTPClient 使用自定义的 HTTP 客户端发送请求，请求超时时间仍然由 SDK 设置
+func WithHTTPClient(client *http.Client) Option {
+	return func(config *beans.ABTestConfig) error {
+		if client == nil {
+			return &ConfigError{Field: "HTTPClientParam.Client", Value: client, Reason: "must not be nil"}
+		}
+		config.HTTPClientParam.Client = client
+		return nil
+	}
+}
+
+// WithRoundTripper 使用自定义的 Transport 发送请求，设置了 WithHTTPClient 时不生效
+func WithRoundTripper(transport http.RoundTripper) Option {
+	return func(config *beans.ABTestConfig) error {
+		if transport == nil {
+			return &ConfigError{Field: "HTTPClientParam.Transport", Value: transport, Reason: "must not be nil"}
+		}
+		config.HTTPClientParam.Transport = transport
+		return nil
+	}
+}
+
+// WithHeaders 设置每个请求都会携带的 Header
+func WithHeaders(headers map[string]string) Option {
+	return func(config *beans.ABTestConfig) error {
+		copyHeaders := make(map[string]string, len(headers))
+		for key, value := range headers {
+			if strings.TrimSpace(key) == "" {
+				return &ConfigError{Field: "HTTPClientParam.Headers", Value: key, Reason: "header name must not be empty"}
+			}
+			copyHeaders[key] = value
+		}
+		config.HTTPClientParam.Headers = copyHeaders
+		return nil
+	}
+}
+
+// WithHeaderProvider 设置每次请求前调用的 Header 生成函数，用于携带会轮换的鉴权 token
+func WithHeaderProvider(provider func() (map[string]string, error)) Option {
+	return func(config *beans.ABTestConfig) error {
+		config.HTTPClientParam.HeaderProvider = provider
+		return nil
+	}
+}
+
+// WithRequestSigner 设置请求签名，例如 utils.NewHMACSigner
+func WithRequestSigner(signer beans.RequestSigner) Option {
+	return func(config *beans.ABTestConfig) error {
+		if signer == nil {
+			return &ConfigError{Field: "HTTPClientParam.Signer", Value: signer, Reason: "must not be nil"}
+		}
+		config.HTTPClientParam.Signer = signer
+		return nil
+	}
+}
+
+// WithCompression 设置请求体和响应体的 gzip 压缩
+func WithCompression(param beans.CompressionParam) Option {
+	return func(config *beans.ABTestConfig) error {
+		if param.RequestGzipMinBytes < 0 {
+			return &ConfigError{Field: "CompressionParam.RequestGzipMinBytes", Value: param.RequestGzipMinBytes, Reason: "must not be negative"}
+		}
+		config.CompressionParam = param
+		return nil
+	}
+}
+
+// WithResponseLimit 设置响应体的最大字节数和是否校验 Content-Type
+func WithResponseLimit(param beans.ResponseParam) Option {
+	return func(config *beans.ABTestConfig) error {
+		if param.MaxBytes < 0 {
+			return &ConfigError{Field: "ResponseParam.MaxBytes", Value: param.MaxBytes, Reason: "must not be negative"}
+		}
+		config.ResponseParam = param
+		return nil
+	}
+}
+
+// WithRequestObserver 设置每次网络请求结束后的回调，可以用于统计耗时、状态码和压缩率
+func WithRequestObserver(observer func(observation beans.RequestObservation)) Option {
+	return func(config *beans.ABTestConfig) error {
+		config.OnRequestObserved = observer
+		return nil
+	}
+}
+
+// WithRequestTimeout 设置请求参数中未设置超时时间时使用的网络请求超时时间，默认 3s
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(config *beans.ABTestConfig) error {
+		if timeout < time.Millisecond {
+			return &ConfigError{Field: "RequestTimeout", Value: timeout, Reason: "must be at least 1ms"}
+		}
+		config.RequestTimeoutMilliseconds = int(timeout / time.Millisecond)
+		return nil
+	}
+}
+
+// WithRetry 设置网络请求失败后的最大重试次数和首次重试间隔，重试间隔每次翻倍，最小 100ms，最大 5s
+// 包括重试在内的总耗时不超过请求的超时时间
+func WithRetry(maxRetries int, backoff time.Duration) Option {
+	return func(config *beans.ABTestConfig) error {
+		if maxRetries < 0 {
+			return &ConfigError{Field: "RetryParam.MaxRetries", Value: maxRetries, Reason: "must not be negative"}
+		}
+		if backoff < 0 {
+			return &ConfigError{Field: "RetryParam.Backoff", Value: backoff, Reason: "must not be negative"}
+		}
+		config.RetryParam = beans.RetryParam{
+			MaxRetries:          maxRetries,
+			BackoffMilliSeconds: int(backoff / time.Millisecond),
+		}
+		return nil
+	}
+}
+
+// WithCassette 设置请求录制回放
+func WithCassette(param beans.CassetteParam) Option {
+	return func(config *beans.ABTestConfig) error {
+		if param.Mode != beans.CassetteModeOff && param.Path == "" {
+			return &ConfigError{Field: "CassetteParam.Path", Value: param.Path, Reason: "must not be empty when cassette is enabled"}
+		}
+		config.CassetteParam = param
+		return nil
+	}
+}
+
+// WithExperimentVersionHook 设置试验版本变化时的回调
+func WithExperimentVersionHook(hook func(experimentId string, oldVersion string, newVersion string)) Option {
+	return func(config *beans.ABTestConfig) error {
+		config.OnExperimentVersionChange = hook
+		return nil
+	}
+}
+
+// WithSensorsAnalytics 设置用于 $ABTestTrigger 埋点的 SensorsAnalytics
+func WithSensorsAnalytics(sa sensorsanalytics.SensorsAnalytics) Option {
+	return func(config *beans.ABTestConfig) error {
+		config.SensorsAnalytics = sa
+		return nil
+	}
+}
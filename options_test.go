@@ -0,0 +1,106 @@
+package sensorsabtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	tests := []struct {
+		field  string
+		apiURL string
+		option Option
+	}{
+		{field: "APIUrl", apiURL: "ftp://ab.example.com"},
+		{field: "APIUrl", apiURL: "/api/v2/abtest/online/results"},
+		{field: "ExperimentCacheTTL", option: WithExperimentCacheTTL(0)},
+		{field: "ExperimentCacheTTL", option: WithExperimentCacheTTL(25 * time.Hour)},
+		{field: "ExperimentCacheSize", option: WithExperimentCacheSize(0)},
+		{field: "EventCacheTTL", option: WithEventCacheTTL(-time.Minute)},
+		{field: "EventCacheSize", option: WithEventCacheSize(-1)},
+		{field: "EndpointParam.URLs", option: WithEndpoints(beans.EndpointParam{URLs: []string{"backup"}})},
+		{field: "EndpointParam.Policy", option: WithEndpoints(beans.EndpointParam{Policy: beans.EndpointPolicy(100)})},
+		{field: "EndpointParam.FailureThreshold", option: WithEndpoints(beans.EndpointParam{FailureThreshold: -1})},
+		{field: "HedgingParam.MaxPercent", option: WithHedging(beans.HedgingParam{Enable: true, MaxPercent: 101})},
+		{field: "HTTPTransportParam.MaxIdleConns", option: WithHTTPTransport(beans.HTTPTransportParam{MaxIdleConns: -1})},
+		{field: "HTTPTransportParam.CertFile", option: WithHTTPTransport(beans.HTTPTransportParam{CertFile: "client.pem"})},
+		{field: "HTTPTransportParam.ProxyURL", option: WithHTTPTransport(beans.HTTPTransportParam{ProxyURL: "ftp://proxy"})},
+		{field: "HTTPClientParam.Client", option: WithHTTPClient(nil)},
+		{field: "HTTPClientParam.Transport", option: WithRoundTripper(nil)},
+		{field: "HTTPClientParam.Headers", option: WithHeaders(map[string]string{"": "value"})},
+		{field: "HTTPClientParam.Signer", option: WithRequestSigner(nil)},
+		{field: "CompressionParam.RequestGzipMinBytes", option: WithCompression(beans.CompressionParam{RequestGzipMinBytes: -1})},
+		{field: "ResponseParam.MaxBytes", option: WithResponseLimit(beans.ResponseParam{MaxBytes: -1})},
+		{field: "RequestTimeout", option: WithRequestTimeout(time.Microsecond)},
+		{field: "RetryParam.MaxRetries", option: WithRetry(-1, 0)},
+		{field: "RetryParam.Backoff", option: WithRetry(1, -time.Second)},
+		{field: "CassetteParam.Path", option: WithCassette(beans.CassetteParam{Mode: beans.CassetteModeRecord})},
+	}
+	for _, test := range tests {
+		t.Run(test.field, func(t *testing.T) {
+			apiURL := test.apiURL
+			if apiURL == "" {
+				apiURL = "http://ab.example.com/api/v2/abtest/online/results"
+			}
+			var opts []Option
+			if test.option != nil {
+				opts = append(opts, test.option)
+			}
+			sensors, err := New(apiURL, opts...)
+			var configError *ConfigError
+			if !errors.As(err, &configError) || configError.Field != test.field {
+				t.Fatalf("expected ConfigError for %s, got %v", test.field, err)
+			}
+			if sensors != nil {
+				t.Fatal("no SensorsABTest should be returned for an invalid option")
+			}
+		})
+	}
+}
+
+func TestInitSensorsABTestReadsCacheTimeAsMinutes(t *testing.T) {
+	tests := []struct {
+		name           string
+		experimentTime time.Duration
+		eventTime      time.Duration
+		wantExperiment time.Duration
+		wantEvent      time.Duration
+	}{
+		{name: "minutes", experimentTime: 5, eventTime: 30, wantExperiment: 5 * time.Minute, wantEvent: 30 * time.Minute},
+		{name: "max", experimentTime: 24 * 60, eventTime: 24 * 60, wantExperiment: 24 * time.Hour, wantEvent: 24 * time.Hour},
+		// 不合法的值被修正为默认的 24 小时，而不是返回错误
+		{name: "unset", wantExperiment: 24 * time.Hour, wantEvent: 24 * time.Hour},
+		{name: "too long", experimentTime: 24*60 + 1, eventTime: -1, wantExperiment: 24 * time.Hour, wantEvent: 24 * time.Hour},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err, sensors := InitSensorsABTest(beans.ABTestConfig{
+				APIUrl:              "http://ab.example.com/api/v2/abtest/online/results",
+				ExperimentCacheTime: test.experimentTime,
+				EventCacheTime:      test.eventTime,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = sensors.Shutdown(context.Background()) }()
+			config := sensors.getConfig()
+			if config.ExperimentCacheTime != test.wantExperiment || config.EventCacheTime != test.wantEvent {
+				t.Fatalf("cache time = %v, %v, want %v, %v", config.ExperimentCacheTime, config.EventCacheTime, test.wantExperiment, test.wantEvent)
+			}
+		})
+	}
+
+	// New 使用真实的 time.Duration
+	sensors, err := New("http://ab.example.com/api/v2/abtest/online/results", WithExperimentCacheTTL(5*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = sensors.Shutdown(context.Background()) }()
+	if ttl := sensors.getConfig().ExperimentCacheTime; ttl != 5*time.Minute {
+		t.Fatalf("ExperimentCacheTTL = %v", ttl)
+	}
+}
@@ -0,0 +1,99 @@
+package sensorsabtest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+	"github.com/sensorsdata/abtesting-sdk-go/utils"
+)
+
+/*
+在后台预热用户的试验缓存，之后的 FastFetchABTest 可以直接命中缓存
+与 FastFetchABTest 使用相同的网络请求和缓存逻辑，但不会触发 $ABTestTrigger 事件
+缓存中已经包含 paramNames 中所有参数的用户会被跳过，paramNames 为空时只要存在未过期的缓存就跳过
+预热结束后通过返回的 channel 发送汇总结果，ctx 结束后不再预热新的用户，正在进行的网络请求会被取消
+*/
+func (sensors *SensorsABTest) Prefetch(ctx context.Context, users []beans.UserRef, paramNames []string, opts beans.PrefetchOptions) <-chan beans.PrefetchSummary {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 8
+	}
+
+	summaryChan := make(chan beans.PrefetchSummary, 1)
+	limiter := utils.NewRateLimiter(opts.RequestsPerSecond)
+	summary := beans.PrefetchSummary{Total: len(users)}
+	summaryLock := sync.Mutex{}
+
+	workers := runConcurrently(ctx, len(users), concurrency, func(index int) {
+		skipped, err := sensors.prefetchUser(ctx, users[index], paramNames, opts, limiter)
+
+		summaryLock.Lock()
+		progress := beans.PrefetchProgress{
+			User:    users[index],
+			Err:     err,
+			Skipped: skipped,
+			Total:   len(users),
+		}
+		if err != nil {
+			summary.Failed++
+			summary.Failures = append(summary.Failures, progress)
+		} else if skipped {
+			summary.Skipped++
+		} else {
+			summary.Succeeded++
+		}
+		progress.Done = summary.Failed + summary.Skipped + summary.Succeeded
+		summaryLock.Unlock()
+
+		if opts.OnProgress != nil {
+			opts.OnProgress(progress)
+		}
+	})
+
+	go func() {
+		workers.Wait()
+		summary.Err = ctx.Err()
+		summaryChan <- summary
+		close(summaryChan)
+	}()
+	return summaryChan
+}
+
+// 预热单个用户，返回是否因为已有缓存而跳过
+func (sensors *SensorsABTest) prefetchUser(ctx context.Context, user beans.UserRef, paramNames []string, opts beans.PrefetchOptions, limiter *utils.RateLimiter) (bool, error) {
+	err := checkId(user.DistinctId)
+	if err == nil && len(user.Properties) > 0 {
+		err = utils.CheckProperty(user.Properties)
+	}
+	if err == nil && len(user.CustomIDs) > 0 {
+		err = utils.CheckCustomIds(user.CustomIDs)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	idKey := getExperimentUserKey(user.DistinctId, user.CustomIDs, user.IsLoginId)
+	if isUserExperimentsCached(idKey, paramNames, sensors.getConfig().ExperimentCacheTime) {
+		return true, nil
+	}
+
+	err = limiter.Wait(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	requestParam := beans.RequestParam{
+		Properties: user.Properties,
+		CustomIDs:  user.CustomIDs,
+	}
+	params := buildRequestParam(user.DistinctId, user.IsLoginId, requestParam)
+	response, _, err := requestExperimentFromNetwork(ctx, sensors, params, int64(opts.TimeoutMilliseconds))
+	if err != nil {
+		return false, err
+	}
+	// 之后命中缓存的 FastFetchABTest 使用该配置埋点
+	setTrackConfig(response.TrackConfig)
+	saveExperiment2Cache(idKey, response.Results)
+	return false, nil
+}
@@ -0,0 +1,63 @@
+package sensorsabtest_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/sensorsdata/abtesting-sdk-go/abtesttest"
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+func TestPrefetchWarmsCacheConcurrently(t *testing.T) {
+	experiment := testExperiment("exp_prefetch", "color", "red", "STRING")
+	experiment.SubjectId = "subject"
+	experiment.SubjectName = "USER"
+	server := abtesttest.NewServer(abtesttest.Fixture{
+		Results:     []beans.InnerExperiment{experiment},
+		TrackConfig: &beans.TrackConfig{TriggerSwitch: true},
+	})
+	defer server.Close()
+	sensors, events := newTestSDK(t, server)
+
+	users := make([]beans.UserRef, 20)
+	for i := range users {
+		users[i] = beans.UserRef{DistinctId: fmt.Sprintf("prefetch_%d", i), IsLoginId: true}
+	}
+	// Prefetch 与读取埋点配置的 FastFetchABTest 并发执行
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func(i int) {
+			defer readers.Done()
+			_, _ = sensors.FastFetchABTest(fmt.Sprintf("reader_%d", i), true, beans.RequestParam{ParamName: "color", DefaultValue: "blue", EnableAutoTrackABEvent: true})
+		}(i)
+	}
+	summary := <-sensors.Prefetch(context.Background(), users, []string{"color"}, beans.PrefetchOptions{Concurrency: 8})
+	readers.Wait()
+	if summary.Succeeded != len(users) || summary.Failed != 0 || summary.Err != nil {
+		t.Fatalf("summary = %+v", summary)
+	}
+	if len(events()) != 4 {
+		t.Fatalf("expected 4 reader events, got %d", len(events()))
+	}
+
+	requestCount := len(server.Requests())
+	err, result := sensors.FastFetchABTest("prefetch_3", true, beans.RequestParam{ParamName: "color", DefaultValue: "blue", EnableAutoTrackABEvent: true})
+	if err != nil || result.Result != "red" {
+		t.Fatalf("FastFetchABTest = %v, %v", result.Result, err)
+	}
+	if len(server.Requests()) != requestCount {
+		t.Fatal("prefetched user should hit the cache")
+	}
+	// 命中缓存时使用 Prefetch 保存的 track_config 埋点
+	if len(events()) != 5 {
+		t.Fatalf("expected cached experiment to be tracked, events = %d", len(events()))
+	}
+
+	summary = <-sensors.Prefetch(context.Background(), users[:5], []string{"color"}, beans.PrefetchOptions{})
+	if summary.Skipped != 5 {
+		t.Fatalf("second prefetch summary = %+v", summary)
+	}
+}
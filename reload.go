@@ -0,0 +1,136 @@
+package sensorsabtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+	"github.com/sensorsdata/abtesting-sdk-go/utils"
+)
+
+// 运行时可以修改的配置，SensorsABTest 按值传递，所有副本共享同一份配置
+type sharedConfig struct {
+	lock      sync.RWMutex
+	config    beans.ABTestConfig
+	endpoints *endpointPool
+	hedger    *hedger
+}
+
+func newSharedConfig(config beans.ABTestConfig) *sharedConfig {
+	return &sharedConfig{config: config, endpoints: newEndpointPool(config), hedger: newHedger(config.HedgingParam)}
+}
+
+// 读取当前配置，未初始化的 SensorsABTest 返回空配置
+func (sensors *SensorsABTest) getConfig() beans.ABTestConfig {
+	if sensors.config == nil {
+		return beans.ABTestConfig{}
+	}
+	sensors.config.lock.RLock()
+	defer sensors.config.lock.RUnlock()
+	return sensors.config.config
+}
+
+// 读取当前的分流接口地址，未初始化的 SensorsABTest 返回 nil
+func (sensors *SensorsABTest) getEndpoints() *endpointPool {
+	if sensors.config == nil {
+		return nil
+	}
+	sensors.config.lock.RLock()
+	defer sensors.config.lock.RUnlock()
+	return sensors.config.endpoints
+}
+
+// 读取对冲请求的状态，未开启对冲时返回 nil
+func (sensors *SensorsABTest) getHedger() *hedger {
+	if sensors.config == nil {
+		return nil
+	}
+	sensors.config.lock.RLock()
+	defer sensors.config.lock.RUnlock()
+	return sensors.config.hedger
+}
+
+/*
+在运行时修改配置，无需重新初始化 SensorsABTest
+超时时间、重试、分流接口地址、对冲请求、缓存时间、缓存大小、HTTP 连接参数、自定义 HTTP 客户端、Header、签名和压缩立即生效，缓存大小调整时保留已有缓存，连接参数调整时正在进行的请求不受影响
+配置项按照 New 的规则校验，任一配置项不合法时不会修改任何配置；录制回放不支持在运行时修改
+*/
+func (sensors *SensorsABTest) UpdateConfig(opts ...Option) error {
+	if sensors.config == nil {
+		return &ConfigError{Field: "SensorsABTest", Value: nil, Reason: "must be created by New or InitSensorsABTest"}
+	}
+	sensors.config.lock.Lock()
+	defer sensors.config.lock.Unlock()
+
+	oldConfig := sensors.config.config
+	config := oldConfig
+	for _, opt := range opts {
+		err := opt(&config)
+		if err != nil {
+			return err
+		}
+	}
+	if config.CassetteParam != oldConfig.CassetteParam {
+		return &ConfigError{Field: "CassetteParam", Value: config.CassetteParam, Reason: "cannot be changed at runtime"}
+	}
+	config.HTTPTransportParam = getHTTPTransPortParam(config)
+
+	if config.HTTPTransportParam != oldConfig.HTTPTransportParam {
+		err := utils.InitTransport(config.HTTPTransportParam)
+		if err != nil {
+			return err
+		}
+	}
+	if config.ExperimentCacheSize != oldConfig.ExperimentCacheSize || config.EventCacheSize != oldConfig.EventCacheSize {
+		resizeCache(config)
+	}
+	if !isSameEndpointParam(config, oldConfig) {
+		// 地址或策略变化后重新开始健康检查
+		sensors.config.endpoints = newEndpointPool(config)
+	}
+	if config.HedgingParam != oldConfig.HedgingParam {
+		sensors.config.hedger = newHedger(config.HedgingParam)
+	}
+	sensors.config.config = config
+	return nil
+}
+
+/*
+使用 LoadFileConfig 重新读取的配置修改运行时配置，可以在配置文件变化时调用
+配置文件中未设置的配置项恢复为默认值，APIUrl 不支持在运行时修改
+*/
+func (sensors *SensorsABTest) UpdateFileConfig(fileConfig beans.FileConfig, opts ...Option) error {
+	if apiURL := sensors.getConfig().APIUrl; fileConfig.APIUrl != "" && fileConfig.APIUrl != apiURL {
+		return &ConfigError{Field: "APIUrl", Value: fileConfig.APIUrl, Reason: "cannot be changed at runtime"}
+	}
+	defaults := []Option{
+		WithExperimentCacheTTL(defaultCacheTime),
+		WithExperimentCacheSize(defaultCacheSize),
+		WithEventCacheTTL(defaultCacheTime),
+		WithEventCacheSize(defaultCacheSize),
+		WithRequestTimeout(3 * time.Second),
+		WithRetry(0, 0),
+		WithEndpoints(beans.EndpointParam{}),
+		WithHedging(beans.HedgingParam{}),
+	}
+	fileOpts, err := fileConfigOptions(fileConfig)
+	if err != nil {
+		return err
+	}
+	opts = append(append(defaults, fileOpts...), opts...)
+	return sensors.UpdateConfig(opts...)
+}
+
+func isSameEndpointParam(config beans.ABTestConfig, oldConfig beans.ABTestConfig) bool {
+	if config.APIUrl != oldConfig.APIUrl || len(config.EndpointParam.URLs) != len(oldConfig.EndpointParam.URLs) {
+		return false
+	}
+	for i, url := range config.EndpointParam.URLs {
+		if url != oldConfig.EndpointParam.URLs[i] {
+			return false
+		}
+	}
+	return config.EndpointParam.Policy == oldConfig.EndpointParam.Policy &&
+		config.EndpointParam.FailureThreshold == oldConfig.EndpointParam.FailureThreshold &&
+		config.EndpointParam.EjectionMilliSeconds == oldConfig.EndpointParam.EjectionMilliSeconds
+}
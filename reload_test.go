@@ -0,0 +1,123 @@
+package sensorsabtest_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	sensorsabtest "github.com/sensorsdata/abtesting-sdk-go"
+	"github.com/sensorsdata/abtesting-sdk-go/abtesttest"
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+func TestUpdateConfigResizeKeepsCache(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{
+		Results: []beans.InnerExperiment{testExperiment("exp_resize", "color", "red", "STRING")},
+	})
+	defer server.Close()
+	sensors, _ := newTestSDK(t, server, sensorsabtest.WithExperimentCacheSize(3))
+	users := []string{"resize_user_1", "resize_user_2", "resize_user_3"}
+	for _, user := range users {
+		fastFetch(t, sensors, server, user, nil, "color", "blue")
+	}
+
+	// 扩容后保留全部缓存
+	if err := sensors.UpdateConfig(sensorsabtest.WithExperimentCacheSize(10)); err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range users {
+		if count := fastFetch(t, sensors, server, user, nil, "color", "blue"); count != len(users) {
+			t.Fatalf("%s should stay cached after growing the cache, got %d requests", user, count)
+		}
+	}
+
+	// 缩容后保留最近使用的缓存
+	if err := sensors.UpdateConfig(sensorsabtest.WithExperimentCacheSize(2)); err != nil {
+		t.Fatal(err)
+	}
+	if count := fastFetch(t, sensors, server, "resize_user_3", nil, "color", "blue"); count != len(users) {
+		t.Fatalf("recent user should stay cached after shrinking the cache, got %d requests", count)
+	}
+	if count := fastFetch(t, sensors, server, "resize_user_1", nil, "color", "blue"); count != len(users)+1 {
+		t.Fatalf("least recently used user should be evicted, got %d requests", count)
+	}
+}
+
+func TestUpdateConfigAppliesToNextRequest(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{
+		Results: []beans.InnerExperiment{testExperiment("exp_update", "color", "red", "STRING")},
+	})
+	defer server.Close()
+	sensors, _ := newTestSDK(t, server)
+
+	// 缓存时间缩短后，已有的缓存按照新的缓存时间过期
+	fastFetch(t, sensors, server, "update_ttl_user", nil, "color", "blue")
+	if err := sensors.UpdateConfig(sensorsabtest.WithExperimentCacheTTL(20 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if count := fastFetch(t, sensors, server, "update_ttl_user", nil, "color", "blue"); count != 2 {
+		t.Fatalf("cache should expire with the new TTL, got %d requests", count)
+	}
+
+	// 超时时间修改后，下一次请求使用新的超时时间
+	server.Reset()
+	server.SetDefault(abtesttest.Fixture{Latency: 300 * time.Millisecond})
+	if err := sensors.UpdateConfig(sensorsabtest.WithRequestTimeout(50 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	startTime := time.Now()
+	if err := fetchColor(t, sensors, "slow_user"); err == nil {
+		t.Fatal("expected the request to time out")
+	}
+	if elapsed := time.Since(startTime); elapsed >= 250*time.Millisecond {
+		t.Fatalf("request took %v with a 50ms timeout", elapsed)
+	}
+}
+
+func TestUpdateConfigRejectsInvalidUpdates(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{
+		Results: []beans.InnerExperiment{testExperiment("exp_reject", "color", "red", "STRING")},
+		Latency: 100 * time.Millisecond,
+	})
+	defer server.Close()
+	sensors, _ := newTestSDK(t, server)
+
+	tests := []struct {
+		name  string
+		field string
+		apply func() error
+	}{
+		{name: "invalid option after a valid one", field: "ExperimentCacheSize", apply: func() error {
+			return sensors.UpdateConfig(sensorsabtest.WithRequestTimeout(10*time.Millisecond), sensorsabtest.WithExperimentCacheSize(0))
+		}},
+		{name: "cassette", field: "CassetteParam", apply: func() error {
+			return sensors.UpdateConfig(sensorsabtest.WithRequestTimeout(10*time.Millisecond),
+				sensorsabtest.WithCassette(beans.CassetteParam{Mode: beans.CassetteModeReplay, Path: "cassette.jsonl"}))
+		}},
+		{name: "file config with another api url", field: "APIUrl", apply: func() error {
+			return sensors.UpdateFileConfig(beans.FileConfig{APIUrl: "http://other.example.com", RequestTimeout: beans.Duration(10 * time.Millisecond)})
+		}},
+		{name: "file config with an invalid policy", field: "EndpointPolicy", apply: func() error {
+			return sensors.UpdateFileConfig(beans.FileConfig{EndpointPolicy: "random", RequestTimeout: beans.Duration(10 * time.Millisecond)})
+		}},
+		{name: "file config with an invalid proxy", field: "HTTPTransportParam.ProxyURL", apply: func() error {
+			return sensors.UpdateFileConfig(beans.FileConfig{
+				RequestTimeout: beans.Duration(10 * time.Millisecond),
+				HTTPTransport:  beans.FileTransportConfig{ProxyURL: "ftp://proxy"},
+			})
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var configError *sensorsabtest.ConfigError
+			if err := test.apply(); !errors.As(err, &configError) || configError.Field != test.field {
+				t.Fatalf("expected ConfigError for %s, got %v", test.field, err)
+			}
+			// 超时时间没有被修改，100ms 的请求仍然成功
+			if err := fetchColor(t, sensors, "reject_user"); err != nil {
+				t.Fatalf("rejected update was partially applied: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package sensorsabtest
+
+import (
+	"context"
+	"time"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+const (
+	// 重试间隔的下限和上限，避免未设置 BackoffMilliSeconds 时立即重试
+	minRetryBackoff = 100 * time.Millisecond
+	maxRetryBackoff = 5 * time.Second
+)
+
+// 首次重试的间隔，限制在 [minRetryBackoff, maxRetryBackoff] 内
+func retryBackoff(param beans.RetryParam) time.Duration {
+	backoff := time.Duration(param.BackoffMilliSeconds) * time.Millisecond
+	if backoff < minRetryBackoff {
+		return minRetryBackoff
+	}
+	if backoff > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return backoff
+}
+
+// 下一次重试的间隔，每次翻倍，不超过 maxRetryBackoff
+func nextRetryBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return backoff
+}
+
+// 等待重试间隔，ctx 结束或者 SDK 关闭时提前返回 false
+func waitRetryBackoff(ctx context.Context, l *lifecycle, backoff time.Duration) bool {
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-l.closed():
+		return false
+	}
+}
@@ -0,0 +1,83 @@
+package sensorsabtest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sensorsabtest "github.com/sensorsdata/abtesting-sdk-go"
+	"github.com/sensorsdata/abtesting-sdk-go/abtesttest"
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+	"github.com/sensorsdata/abtesting-sdk-go/utils"
+)
+
+func fetchUnavailable(sensors *sensorsabtest.SensorsABTest, timeoutMs int) error {
+	err, _ := sensors.AsyncFetchABTest("retry_user", true, beans.RequestParam{ParamName: "color", DefaultValue: "blue", TimeoutMilliseconds: timeoutMs})
+	var statusError *utils.StatusError
+	if !errors.As(err, &statusError) || statusError.StatusCode != 503 {
+		return err
+	}
+	return nil
+}
+
+func TestRetryIsBoundedByTimeout(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{StatusCode: 503, RawBody: "unavailable"})
+	defer server.Close()
+	sensors, _ := newTestSDK(t, server, sensorsabtest.WithRetry(10, 100*time.Millisecond))
+
+	startTime := time.Now()
+	if err := fetchUnavailable(sensors, 300); err != nil {
+		t.Fatalf("expected 503, got %v", err)
+	}
+	if elapsed := time.Since(startTime); elapsed > 500*time.Millisecond {
+		t.Fatalf("retries took %v, timeout is 300ms", elapsed)
+	}
+	if count := len(server.Requests()); count < 2 || count > 3 {
+		t.Fatalf("expected 2 or 3 requests within the timeout, got %d", count)
+	}
+}
+
+func TestRetryEnforcesMinimumBackoff(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{StatusCode: 503, RawBody: "unavailable"})
+	defer server.Close()
+	sensors, _ := newTestSDK(t, server, sensorsabtest.WithRetry(2, 0))
+
+	startTime := time.Now()
+	if err := fetchUnavailable(sensors, 3000); err != nil {
+		t.Fatalf("expected 503, got %v", err)
+	}
+	// 未设置重试间隔时按 100ms、200ms 等待
+	if elapsed := time.Since(startTime); elapsed < 300*time.Millisecond {
+		t.Fatalf("retries took %v, expected at least 300ms of backoff", elapsed)
+	}
+	if count := len(server.Requests()); count != 3 {
+		t.Fatalf("expected 3 requests, got %d", count)
+	}
+}
+
+func TestShutdownInterruptsRetryBackoff(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{StatusCode: 503, RawBody: "unavailable"})
+	defer server.Close()
+	sensors, _ := newTestSDK(t, server, sensorsabtest.WithRetry(1, 2*time.Second))
+
+	fetched := make(chan error, 1)
+	go func() {
+		fetched <- fetchUnavailable(sensors, 5000)
+	}()
+	waitForRequests(t, server, 1)
+
+	startTime := time.Now()
+	if err := sensors.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(startTime); elapsed > 500*time.Millisecond {
+		t.Fatalf("Shutdown waited %v for the retry backoff", elapsed)
+	}
+	if err := <-fetched; err != nil {
+		t.Fatalf("expected the last 503 error, got %v", err)
+	}
+	if count := len(server.Requests()); count != 1 {
+		t.Fatalf("expected no retry after Shutdown, got %d requests", count)
+	}
+}
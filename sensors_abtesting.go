@@ -1,13 +1,12 @@
 package sensorsabtest
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"time"
 
 	"github.com/sensorsdata/abtesting-sdk-go/beans"
 	"github.com/sensorsdata/abtesting-sdk-go/utils"
-	sensorsanalytics "github.com/sensorsdata/sa-sdk-go"
 )
 
 const (
@@ -27,15 +26,16 @@ type BuildAllExperimentsResultParams struct {
 }
 
 type SensorsABTest struct {
-	config           beans.ABTestConfig
-	sensorsAnalytics sensorsanalytics.SensorsAnalytics
+	// 缓存时间为真实的 time.Duration，不再以分钟为单位，可以通过 UpdateConfig 修改
+	config    *sharedConfig
+	lifecycle *lifecycle
 }
 
 func InitSensorsABTest(abConfig beans.ABTestConfig) (error, SensorsABTest) {
 	err, copyConfig := initConfig(abConfig)
 	return err, SensorsABTest{
-		config:           copyConfig,
-		sensorsAnalytics: abConfig.SensorsAnalytics,
+		config:    newSharedConfig(copyConfig),
+		lifecycle: newLifecycle(),
 	}
 }
 
@@ -43,7 +43,10 @@ func InitSensorsABTest(abConfig beans.ABTestConfig) (error, SensorsABTest) {
 拉取最新试验计划
 */
 func (sensors *SensorsABTest) AsyncFetchABTest(distinctId string, isLoginId bool, requestParam beans.RequestParam) (error, beans.Experiment) {
-	err := checkId(distinctId)
+	err := sensors.checkShutdown()
+	if err == nil {
+		err = checkId(distinctId)
+	}
 	if err == nil {
 		err = checkRequestParams(requestParam)
 	}
@@ -68,7 +71,10 @@ func (sensors *SensorsABTest) AsyncFetchABTest(distinctId string, isLoginId bool
 优先从缓存获取试验变量，如果缓存没有则从网络拉取
 */
 func (sensors *SensorsABTest) FastFetchABTest(distinctId string, isLoginId bool, requestParam beans.RequestParam) (error, beans.Experiment) {
-	err := checkId(distinctId)
+	err := sensors.checkShutdown()
+	if err == nil {
+		err = checkId(distinctId)
+	}
 	if err == nil {
 		err = checkRequestParams(requestParam)
 	}
@@ -130,6 +136,14 @@ func checkRequestParams(param beans.RequestParam) error {
 	return err
 }
 
+// 已经调用过 Shutdown 时返回 ErrShutdown
+func (sensors *SensorsABTest) checkShutdown() error {
+	if sensors.lifecycle.isShutdown() {
+		return ErrShutdown
+	}
+	return nil
+}
+
 func checkId(id string) error {
 	if id == "" {
 		return errors.New("DistinctId must not be empty")
@@ -137,6 +151,8 @@ func checkId(id string) error {
 	return nil
 }
 
+// 兼容 ABTestConfig 的初始化方式，不合法的值会被修正为默认值
+// 返回的配置中缓存时间已从分钟换算为 time.Duration
 func initConfig(abConfig beans.ABTestConfig) (error, beans.ABTestConfig) {
 	if abConfig.APIUrl == "" {
 		return errors.New("APIUrl must not be null or empty"), abConfig
@@ -156,24 +172,69 @@ func initConfig(abConfig beans.ABTestConfig) (error, beans.ABTestConfig) {
 	}
 
 	if abConfig.ExperimentCacheTime <= 0 || abConfig.ExperimentCacheTime > 24*60 {
-		config.ExperimentCacheTime = 24 * 60
+		config.ExperimentCacheTime = 24 * time.Hour
 	} else {
-		config.ExperimentCacheTime = abConfig.ExperimentCacheTime
+		config.ExperimentCacheTime = abConfig.ExperimentCacheTime * time.Minute
 	}
 
 	if abConfig.EventCacheTime <= 0 || abConfig.EventCacheTime > 24*60 {
-		config.EventCacheTime = 24 * 60
+		config.EventCacheTime = 24 * time.Hour
 	} else {
-		config.EventCacheTime = abConfig.EventCacheTime
+		config.EventCacheTime = abConfig.EventCacheTime * time.Minute
 	}
 
 	config.SensorsAnalytics = abConfig.SensorsAnalytics
 	config.EnableEventCache = abConfig.EnableEventCache
 	config.EnableRecordRequestCostTime = abConfig.EnableRecordRequestCostTime
 	config.APIUrl = abConfig.APIUrl
+	config.EndpointParam = abConfig.EndpointParam
+	config.HedgingParam = abConfig.HedgingParam
+	config.CassetteParam = abConfig.CassetteParam
+	config.HTTPClientParam = abConfig.HTTPClientParam
+	config.CompressionParam = abConfig.CompressionParam
+	config.ResponseParam = abConfig.ResponseParam
+	config.OnRequestObserved = abConfig.OnRequestObserved
+	config.OnExperimentVersionChange = abConfig.OnExperimentVersionChange
+	config.HTTPTransportParam = getHTTPTransPortParam(abConfig)
+
+	if abConfig.RequestTimeoutMilliseconds <= 0 {
+		config.RequestTimeoutMilliseconds = 3 * 1000
+	} else {
+		config.RequestTimeoutMilliseconds = abConfig.RequestTimeoutMilliseconds
+	}
+
+	if abConfig.RetryParam.MaxRetries > 0 {
+		config.RetryParam.MaxRetries = abConfig.RetryParam.MaxRetries
+	}
+	if abConfig.RetryParam.BackoffMilliSeconds > 0 {
+		config.RetryParam.BackoffMilliSeconds = abConfig.RetryParam.BackoffMilliSeconds
+	}
+	return applyConfig(config), config
+}
+
+// 使用校验后的配置初始化缓存、录制回放和 HTTP 连接
+func applyConfig(config beans.ABTestConfig) error {
+	err := utils.InitCassette(config.CassetteParam)
+	if err != nil {
+		return err
+	}
+	err = utils.InitTransport(config.HTTPTransportParam)
+	if err != nil {
+		return err
+	}
 	initCache(config)
-	utils.InitTransport(getHTTPTransPortParam(abConfig))
-	return nil, config
+	return nil
+}
+
+// 每次请求使用所属 SensorsABTest 的配置，自定义客户端、Header 和签名只对当前实例生效
+func requestConfig(config beans.ABTestConfig) utils.RequestConfig {
+	return utils.RequestConfig{
+		HTTPClientParam:             config.HTTPClientParam,
+		CompressionParam:            config.CompressionParam,
+		OnRequestObserved:           config.OnRequestObserved,
+		ResponseParam:               config.ResponseParam,
+		EnableRecordRequestCostTime: config.EnableRecordRequestCostTime,
+	}
 }
 
 func getHTTPTransPortParam(abConfig beans.ABTestConfig) beans.HTTPTransportParam {
@@ -212,6 +273,12 @@ func getHTTPTransPortParam(abConfig beans.ABTestConfig) beans.HTTPTransportParam
 	} else {
 		param.DialKeepAliveMilliSeconds = abConfig.HTTPTransportParam.DialKeepAliveMilliSeconds
 	}
+
+	param.CAFile = abConfig.HTTPTransportParam.CAFile
+	param.CertFile = abConfig.HTTPTransportParam.CertFile
+	param.KeyFile = abConfig.HTTPTransportParam.KeyFile
+	param.ProxyURL = abConfig.HTTPTransportParam.ProxyURL
+	param.InsecureSkipVerifyForTestingOnly = abConfig.HTTPTransportParam.InsecureSkipVerifyForTestingOnly
 	return param
 }
 
@@ -220,17 +287,26 @@ func getHTTPTransPortParam(abConfig beans.ABTestConfig) beans.HTTPTransportParam
 强制从网络获取最新数据，不使用缓存
 */
 func (sensors *SensorsABTest) FetchAllExperiments(distinctId string, isLoginId bool, requestParam beans.FetchAllRequestParam) (error, beans.AllExperimentsResult) {
+	err, result, _ := sensors.fetchAllExperiments(context.Background(), distinctId, isLoginId, requestParam)
+	return err, result
+}
+
+// 从网络获取所有试验，同时返回解析后的响应，便于调用方写入缓存，ctx 结束时取消正在进行的请求
+func (sensors *SensorsABTest) fetchAllExperiments(ctx context.Context, distinctId string, isLoginId bool, requestParam beans.FetchAllRequestParam) (error, beans.AllExperimentsResult, utils.Response) {
 	// 参数校验
-	err := checkId(distinctId)
+	err := sensors.checkShutdown()
+	if err == nil {
+		err = checkId(distinctId)
+	}
 	if err != nil {
-		return err, beans.AllExperimentsResult{}
+		return err, beans.AllExperimentsResult{}, utils.Response{}
 	}
 
 	// 检查自定义属性
 	if len(requestParam.Properties) > 0 {
 		err = utils.CheckProperty(requestParam.Properties)
 		if err != nil {
-			return err, beans.AllExperimentsResult{}
+			return err, beans.AllExperimentsResult{}, utils.Response{}
 		}
 	}
 
@@ -238,21 +314,23 @@ func (sensors *SensorsABTest) FetchAllExperiments(distinctId string, isLoginId b
 	if len(requestParam.CustomIDs) > 0 {
 		err = utils.CheckCustomIds(requestParam.CustomIDs)
 		if err != nil {
-			return err, beans.AllExperimentsResult{}
+			return err, beans.AllExperimentsResult{}, utils.Response{}
 		}
 	}
 
 	// 从网络获取所有试验
 	params := buildGetAllRequestParam(distinctId, isLoginId, requestParam)
-	experimentResponse, rawResponseBody, err := requestExperimentFromNetwork(sensors, params, int64(requestParam.TimeoutMilliseconds))
+	experimentResponse, rawResponseBody, err := requestExperimentFromNetwork(ctx, sensors, params, int64(requestParam.TimeoutMilliseconds))
 	if err != nil {
 		return err, beans.NewAllExperimentsResultBuilder().
 			DistinctId(distinctId).
 			IsLoginId(isLoginId).
 			CustomIDs(requestParam.CustomIDs).
 			Experiments(make(map[string]beans.InnerExperiment)).
-			Timestamp(time.Now().UnixMilli()).Build()
+			Timestamp(time.Now().UnixMilli()).Build(), utils.Response{}
 	}
+	// 保存埋点配置，缓存命中时使用
+	setTrackConfig(experimentResponse.TrackConfig)
 
 	// 使用通用辅助函数构建结果
 	buildParams := BuildAllExperimentsResultParams{
@@ -265,11 +343,24 @@ func (sensors *SensorsABTest) FetchAllExperiments(distinctId string, isLoginId b
 	}
 	result := sensors.buildAllExperimentsResult(buildParams)
 
-	return nil, result
+	return nil, result, experimentResponse
 }
 
 // 通用的构建 AllExperimentsResult 的辅助函数
 func (sensors *SensorsABTest) buildAllExperimentsResult(params BuildAllExperimentsResultParams) beans.AllExperimentsResult {
+	trackConfig := params.ExperimentResponse.TrackConfig
+	return BuildAllExperimentsResult(params, func(paramName string, experiment beans.InnerExperiment) {
+		trackABTestEvent(params.DistinctId, params.IsLoginId, experiment, sensors, nil, params.CustomIDs, trackConfig)
+	})
+}
+
+/*
+BuildAllExperimentsResult 按照 SDK 的规则从分流响应构建 AllExperimentsResult
+results 中同一参数以第一个试验为准，白名单试验优先；out_list 中的试验不返回试验值，只在读取相同参数时曝光
+开启 EnableAutoTrackABEvent 时，读取参数后对每个需要曝光的试验调用 track
+abtesttest 等需要与 SDK 行为保持一致的实现可以直接使用
+*/
+func BuildAllExperimentsResult(params BuildAllExperimentsResultParams, track func(paramName string, experiment beans.InnerExperiment)) beans.AllExperimentsResult {
 	// 构建参数名到试验的映射
 	experimentsMap := make(map[string]beans.InnerExperiment)
 
@@ -301,26 +392,16 @@ func (sensors *SensorsABTest) buildAllExperimentsResult(params BuildAllExperimen
 
 	// 创建埋点回调函数（如果启用）
 	var trackCallback func(string, beans.InnerExperiment)
-	if params.EnableAutoTrackABEvent {
-		// 闭包捕获当前上下文
-		capturedDistinctId := params.DistinctId
-		capturedIsLoginId := params.IsLoginId
-		capturedCustomIDs := params.CustomIDs
-		capturedTrackConfig := params.ExperimentResponse.TrackConfig
-		capturedSensors := sensors
-		capturedOutListMap := outListMap
-
+	if params.EnableAutoTrackABEvent && track != nil {
 		trackCallback = func(paramName string, experiment beans.InnerExperiment) {
 			// 先为主要试验（results）埋点
 			// 不为 0 值
 			if experiment.AbtestExperimentId != "" {
-				trackABTestEvent(capturedDistinctId, capturedIsLoginId, experiment, capturedSensors, nil, capturedCustomIDs, capturedTrackConfig)
+				track(paramName, experiment)
 			}
 			// 检查 out_list 中是否也有相同参数的试验，如果有也要埋点
-			if outExperiments, exists := capturedOutListMap[paramName]; exists {
-				for _, outExperiment := range outExperiments {
-					trackABTestEvent(capturedDistinctId, capturedIsLoginId, outExperiment, capturedSensors, nil, capturedCustomIDs, capturedTrackConfig)
-				}
+			for _, outExperiment := range outListMap[paramName] {
+				track(paramName, outExperiment)
 			}
 		}
 	}
@@ -377,12 +458,17 @@ func (sensors *SensorsABTest) loadAllExperimentsFromResponseBody(data beans.Dump
 }
 
 /*
-从序列化的 JSON 字符串加载 AllExperimentsResult
+从序列化的字符串加载 AllExperimentsResult
+自动识别原始 JSON 格式和 DumpWithFormat 生成的压缩格式
 */
 func (sensors *SensorsABTest) LoadAllExperiments(distinctId string, isLoginId bool, param beans.LoadDumpedParam, dumpData string) (error, beans.AllExperimentsResult) {
+	err := sensors.checkShutdown()
+	if err != nil {
+		return err, beans.AllExperimentsResult{}
+	}
+
 	// 解析序列化数据
-	var data beans.DumpData
-	err := json.Unmarshal([]byte(dumpData), &data)
+	data, err := beans.DecodeDumpData(dumpData)
 	if err != nil {
 		return err, beans.AllExperimentsResult{}
 	}
@@ -405,6 +491,42 @@ func (sensors *SensorsABTest) LoadAllExperiments(distinctId string, isLoginId bo
 		return errors.New("user identity (CustomIDs) mismatch"), beans.AllExperimentsResult{}
 	}
 
+	// 校验序列化数据是否过期
+	err = checkDumpAge(data, param)
+	if err != nil {
+		if param.RefreshOnExpired {
+			return sensors.FetchAllExperiments(distinctId, isLoginId, beans.FetchAllRequestParam{
+				Properties:             param.Properties,
+				CustomIDs:              param.CustomIDs,
+				TimeoutMilliseconds:    param.TimeoutMilliseconds,
+				EnableAutoTrackABEvent: param.EnableAutoTrackABEvent,
+			})
+		}
+		return err, beans.AllExperimentsResult{}
+	}
+
 	// 调用原有的方法，传入解析出的参数（包括 CustomIDs）
 	return sensors.loadAllExperimentsFromResponseBody(data, param.EnableAutoTrackABEvent)
 }
+
+// 检查序列化数据的时长是否超过 MaxAge，未设置 MaxAge 时不校验
+// 没有时间戳（Timestamp 为 0）的旧版本数据无法判断时长，按照过期处理
+func checkDumpAge(data beans.DumpData, param beans.LoadDumpedParam) error {
+	if param.MaxAge <= 0 {
+		return nil
+	}
+	tolerance := param.ClockSkewTolerance
+	if tolerance < 0 {
+		tolerance = 0
+	}
+
+	age := time.Duration(time.Now().UnixMilli()-data.Timestamp) * time.Millisecond
+	if age > param.MaxAge+tolerance || age < -tolerance {
+		return &DumpExpiredError{
+			Timestamp: data.Timestamp,
+			Age:       age,
+			MaxAge:    param.MaxAge,
+		}
+	}
+	return nil
+}
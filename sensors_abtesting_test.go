@@ -0,0 +1,203 @@
+package sensorsabtest_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sensorsabtest "github.com/sensorsdata/abtesting-sdk-go"
+	"github.com/sensorsdata/abtesting-sdk-go/abtesttest"
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+	"github.com/sensorsdata/abtesting-sdk-go/utils"
+	sensorsanalytics "github.com/sensorsdata/sa-sdk-go"
+)
+
+// 创建请求 server 的 SensorsABTest，返回读取 $ABTestTrigger 事件的函数
+func newTestSDK(t *testing.T, server *abtesttest.Server, opts ...sensorsabtest.Option) (*sensorsabtest.SensorsABTest, func() []sensorsabtest.TrackedEvent) {
+	t.Helper()
+	consumer, err := sensorsanalytics.InitConcurrentLoggingConsumer(filepath.Join(t.TempDir(), "sa.log"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sa := sensorsanalytics.InitSensorsAnalytics(consumer, "default", false)
+	t.Cleanup(func() { sa.Close() })
+	events := sensorsabtest.RecordTrackedEvents(t.Cleanup)
+
+	sensors, err := sensorsabtest.New(server.URL, append([]sensorsabtest.Option{sensorsabtest.WithSensorsAnalytics(sa)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sensors.Shutdown(context.Background()) })
+	return sensors, events
+}
+
+func testExperiment(experimentId string, paramName string, value string, variableType string) beans.InnerExperiment {
+	return beans.InnerExperiment{
+		AbtestExperimentId:       experimentId,
+		AbtestExperimentGroupId:  "0",
+		AbtestExperimentResultId: experimentId + "_result",
+		Cacheable:                true,
+		VariableList:             []beans.Variables{{Name: paramName, Value: value, Type: variableType}},
+	}
+}
+
+func trackedExperimentIds(events []sensorsabtest.TrackedEvent) []string {
+	ids := make([]string, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.Properties["$abtest_experiment_id"].(string))
+	}
+	return ids
+}
+
+func TestFastFetchABTestUsesCache(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{
+		Results: []beans.InnerExperiment{testExperiment("exp_cache", "color", "red", "STRING")},
+	})
+	defer server.Close()
+	sensors, _ := newTestSDK(t, server)
+
+	for i := 0; i < 3; i++ {
+		err, experiment := sensors.FastFetchABTest("cache_user", true, beans.RequestParam{ParamName: "color", DefaultValue: "blue"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if experiment.Result != "red" {
+			t.Fatalf("call %d: result = %v", i, experiment.Result)
+		}
+	}
+	if requests := server.Requests(); len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+
+	// 其他用户没有缓存
+	_, _ = sensors.FastFetchABTest("other_user", true, beans.RequestParam{ParamName: "color", DefaultValue: "blue"})
+	if requests := server.Requests(); len(requests) != 2 || requests[1].DistinctId != "other_user" {
+		t.Fatalf("requests = %+v", requests)
+	}
+}
+
+func TestOutListExperimentsAreExposed(t *testing.T) {
+	server := abtesttest.NewServer(abtesttest.Fixture{
+		Results: []beans.InnerExperiment{testExperiment("exp_result", "color", "red", "STRING")},
+		OutList: []beans.InnerExperiment{testExperiment("exp_out", "color", "green", "STRING")},
+	})
+	defer server.Close()
+	sensors, events := newTestSDK(t, server)
+
+	err, experiment := sensors.AsyncFetchABTest("out_user", false, beans.RequestParam{ParamName: "color", DefaultValue: "blue", EnableAutoTrackABEvent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if experiment.Result != "red" {
+		t.Fatalf("result = %v", experiment.Result)
+	}
+	if ids := trackedExperimentIds(events()); strings.Join(ids, ",") != "exp_result,exp_out" {
+		t.Fatalf("tracked experiments = %v", ids)
+	}
+
+	err, result := sensors.FetchAllExperiments("out_user", false, beans.FetchAllRequestParam{EnableAutoTrackABEvent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := result.GetValue("color", "blue"); value != "red" {
+		t.Fatalf("FetchAll value = %v", value)
+	}
+	if ids := trackedExperimentIds(events()); strings.Join(ids, ",") != "exp_result,exp_out,exp_result,exp_out" {
+		t.Fatalf("tracked experiments = %v", ids)
+	}
+}
+
+func TestFetchABTestErrorResponses(t *testing.T) {
+	cases := []struct {
+		name    string
+		fixture abtesttest.Fixture
+		check   func(err error) bool
+	}{
+		{
+			name:    "failed status",
+			fixture: abtesttest.Fixture{Error: "project not found", ErrorType: "INVALID"},
+			check:   func(err error) bool { return strings.HasSuffix(err.Error(), "project not found") },
+		},
+		{
+			name:    "server error",
+			fixture: abtesttest.Fixture{StatusCode: 503, RawBody: "unavailable"},
+			check: func(err error) bool {
+				var statusError *utils.StatusError
+				return errors.As(err, &statusError) && statusError.StatusCode == 503
+			},
+		},
+		{
+			name:    "malformed body",
+			fixture: abtesttest.Fixture{RawBody: `{"status":"SUCCESS","results":[`},
+			check:   func(err error) bool { return err != nil },
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := abtesttest.NewServer(c.fixture)
+			defer server.Close()
+			sensors, events := newTestSDK(t, server)
+
+			param := beans.RequestParam{ParamName: "color", DefaultValue: "blue", EnableAutoTrackABEvent: true}
+			err, experiment := sensors.AsyncFetchABTest("error_user", true, param)
+			if err == nil || !c.check(err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if experiment.Result != "blue" {
+				t.Fatalf("result = %v", experiment.Result)
+			}
+
+			// 失败的响应不会被缓存
+			err, _ = sensors.FastFetchABTest("error_user", true, param)
+			if err == nil {
+				t.Fatal("expected FastFetchABTest to fail")
+			}
+			if len(server.Requests()) != 2 {
+				t.Fatalf("expected 2 requests, got %d", len(server.Requests()))
+			}
+			if len(events()) != 0 {
+				t.Fatalf("unexpected events: %+v", events())
+			}
+		})
+	}
+}
+
+func FuzzLoadAllExperiments(f *testing.F) {
+	bodies := []string{
+		`{"status":"SUCCESS","results":[{"abtest_experiment_id":"1","abtest_experiment_group_id":"0","abtest_experiment_result_id":"2","variables":[{"name":"color","value":"red","type":"STRING"}]}]}`,
+		`{"status":"SUCCESS","track_config":{"trigger_switch":true,"trigger_content_ext":["custom_ext"]},"results":[{"abtest_experiment_id":"1","abtest_experiment_group_id":"0","abtest_experiment_result_id":"2","custom_ext":12}]}`,
+		`{"status":"SUCCESS","track_config":{"trigger_switch":true,"trigger_content_ext":["custom_ext"]},"results":[{"abtest_experiment_id":"1","abtest_experiment_group_id":"0","abtest_experiment_result_id":"2","custom_ext":true}]}`,
+		`{"status":"SUCCESS","track_config":{"trigger_switch":true,"trigger_content_ext":["custom_ext"]},"out_list":[{"abtest_experiment_id":"1","abtest_experiment_group_id":"0","abtest_experiment_result_id":"2","custom_ext":{"a":1}}]}`,
+		`{"status":"SUCCESS","results":[{"abtest_experiment_id":{"a":1},"abtest_experiment_group_id":"0","abtest_experiment_result_id":"2"}]}`,
+		`{"status":"SUCCESS","results":{"abtest_experiment_id":"1"}}`,
+		`{"status":"SUCCESS","results":[],"track_config":null}`,
+	}
+	for _, body := range bodies {
+		for _, format := range []beans.DumpFormat{beans.DumpFormatJSON, beans.DumpFormatGzip} {
+			dump, err := beans.EncodeDumpData(beans.DumpData{DistinctId: "fuzz_user", IsLoginId: true, ResponseBody: body}, format)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(dump)
+		}
+	}
+	f.Add(`{"distinct_id":"fuzz_user","is_login_id":true,"response_body":1}`)
+
+	sensors, err := sensorsabtest.New("http://127.0.0.1:1/api/v2/abtest/online/results")
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Cleanup(func() { _ = sensors.Shutdown(context.Background()) })
+	f.Fuzz(func(t *testing.T, dump string) {
+		err, result := sensors.LoadAllExperiments("fuzz_user", true, beans.LoadDumpedParam{}, dump)
+		if err != nil {
+			return
+		}
+		_ = result.GetValue("color", "blue")
+		if _, err = result.Dump(); err != nil {
+			t.Fatalf("loaded result cannot be dumped: %v", err)
+		}
+	})
+}
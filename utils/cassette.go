@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+// ErrCassetteMissing 回放模式下找不到匹配的录制记录
+var ErrCassetteMissing = errors.New("no recorded response found in cassette")
+
+// 回放时找不到录制记录并且配置为返回默认值时使用的响应体
+const emptyResponseBody = `{"status":"SUCCESS","results":[],"out_list":[]}`
+
+// 录制文件中的一条记录
+type cassetteInteraction struct {
+	Key        string                 `json:"key"`
+	URL        string                 `json:"url"`
+	Request    map[string]interface{} `json:"request"`
+	StatusCode int                    `json:"status_code"`
+	Header     http.Header            `json:"header"`
+	Body       string                 `json:"body"`
+	RecordedAt int64                  `json:"recorded_at"`
+}
+
+type cassette struct {
+	param beans.CassetteParam
+	lock  sync.Mutex
+	// 回放模式下按照请求参数分组的录制记录，相同请求按照录制顺序依次返回
+	interactions map[string][]cassetteInteraction
+	replayIndex  map[string]int
+}
+
+var currentCassette *cassette
+var cassetteLock = sync.RWMutex{}
+
+// InitCassette 初始化录制回放，回放模式下会一次性加载录制文件
+func InitCassette(param beans.CassetteParam) error {
+	if param.Mode == beans.CassetteModeOff {
+		setCassette(nil)
+		return nil
+	}
+	if param.Path == "" {
+		return errors.New("CassetteParam.Path must not be empty")
+	}
+
+	c := &cassette{
+		param:        param,
+		interactions: make(map[string][]cassetteInteraction),
+		replayIndex:  make(map[string]int),
+	}
+	if param.Mode == beans.CassetteModeReplay {
+		err := c.load()
+		if err != nil {
+			return err
+		}
+	}
+	setCassette(c)
+	return nil
+}
+
+func setCassette(c *cassette) {
+	cassetteLock.Lock()
+	defer cassetteLock.Unlock()
+	currentCassette = c
+}
+
+// IsCassetteEnabled 返回是否开启了录制或回放
+func IsCassetteEnabled() bool {
+	return getCassette() != nil
+}
+
+// 未开启录制回放时返回 nil
+func getCassette() *cassette {
+	cassetteLock.RLock()
+	defer cassetteLock.RUnlock()
+	return currentCassette
+}
+
+func (c *cassette) load() error {
+	file, err := os.Open(c.param.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open cassette: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var interaction cassetteInteraction
+		err = json.Unmarshal(scanner.Bytes(), &interaction)
+		if err != nil {
+			return fmt.Errorf("failed to parse cassette line %d: %w", line, err)
+		}
+		c.interactions[interaction.Key] = append(c.interactions[interaction.Key], interaction)
+	}
+	return scanner.Err()
+}
+
+// 录制响应，读取完响应体后返回一个可以再次读取的响应
+func (c *cassette) record(url string, requestParams map[string]interface{}, resp *http.Response, param beans.ResponseParam) (*http.Response, error) {
+	// 录制解压后的响应体，录制文件中不保存二进制内容
+	if _, err := decodeContentEncoding(resp); err != nil {
+		return nil, err
+	}
+	// 和 processHttpResponse 使用相同的大小限制，超过限制时不录制
+	body, err := readBoundedBody(resp.Body, param)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	key, err := cassetteKey(requestParams)
+	if err != nil {
+		return resp, err
+	}
+	line, err := json.Marshal(cassetteInteraction{
+		Key:        key,
+		URL:        url,
+		Request:    requestParams,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       string(body),
+		RecordedAt: time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return resp, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	file, err := os.OpenFile(c.param.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Println("record cassette failed, error : ", err)
+		return resp, nil
+	}
+	defer file.Close()
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		fmt.Println("record cassette failed, error : ", err)
+	}
+	return resp, nil
+}
+
+// 回放响应，相同的请求按照录制顺序返回，用完后重复返回最后一条
+func (c *cassette) replay(requestParams map[string]interface{}) (*http.Response, error) {
+	key, err := cassetteKey(requestParams)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	interactions := c.interactions[key]
+	index := c.replayIndex[key]
+	if index < len(interactions)-1 {
+		c.replayIndex[key] = index + 1
+	}
+	c.lock.Unlock()
+
+	if len(interactions) == 0 {
+		if c.param.MissingBehavior == beans.CassetteMissingDefault {
+			return buildReplayResponse(http.StatusOK, http.Header{}, emptyResponseBody), nil
+		}
+		return nil, ErrCassetteMissing
+	}
+	interaction := interactions[index]
+	return buildReplayResponse(interaction.StatusCode, interaction.Header, interaction.Body), nil
+}
+
+func buildReplayResponse(statusCode int, header http.Header, body string) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(statusCode) + " " + http.StatusText(statusCode),
+		StatusCode:    statusCode,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(body))),
+		ContentLength: int64(len(body)),
+	}
+}
+
+// 请求参数决定录制记录的唯一标识，json.Marshal 对 map 的 key 排序，保证结果稳定
+// 不包含 URL，录制文件可以在不同环境中回放
+func cassetteKey(requestParams map[string]interface{}) (string, error) {
+	data, err := json.Marshal(requestParams)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request params: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+const cassetteTestBody = `{"status":"SUCCESS","results":[{"abtest_experiment_id":"1","abtest_experiment_group_id":"0","abtest_experiment_result_id":"2","variables":[{"name":"color","value":"red","type":"STRING"}]}]}`
+
+func TestCassetteRecordsAndReplaysHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("X-AB-Request-Id", "request-1")
+		_, _ = writer.Write([]byte(cassetteTestBody))
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+	defer func() { _ = InitCassette(beans.CassetteParam{}) }()
+	params := map[string]interface{}{"login_id": "user"}
+
+	if err := InitCassette(beans.CassetteParam{Mode: beans.CassetteModeRecord, Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := RequestExperiment(server.URL, params, time.Second, false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var interaction cassetteInteraction
+	if err = json.Unmarshal([]byte(strings.TrimSpace(string(data))), &interaction); err != nil {
+		t.Fatal(err)
+	}
+	if interaction.Header.Get("X-AB-Request-Id") != "request-1" || interaction.Body != cassetteTestBody {
+		t.Fatalf("recorded interaction = %+v", interaction)
+	}
+
+	server.Close()
+	if err = InitCassette(beans.CassetteParam{Mode: beans.CassetteModeReplay, Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := getCassette().replay(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get("X-AB-Request-Id") != "request-1" || resp.StatusCode != http.StatusOK {
+		t.Fatalf("replayed response = %+v", resp)
+	}
+	response, body, err := RequestExperiment(server.URL, params, time.Second, false)
+	if err != nil || body != cassetteTestBody || len(response.Results) != 1 {
+		t.Fatalf("replay = %+v, %q, %v", response, body, err)
+	}
+
+	if _, _, err = RequestExperiment(server.URL, map[string]interface{}{"login_id": "other"}, time.Second, false); err != ErrCassetteMissing {
+		t.Fatalf("expected ErrCassetteMissing, got %v", err)
+	}
+}
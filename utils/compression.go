@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+// 请求体达到阈值时进行 gzip 压缩，返回实际发送的请求体和是否压缩
+func compressRequestBody(data []byte, param beans.CompressionParam) ([]byte, bool, error) {
+	minBytes := param.RequestGzipMinBytes
+	if minBytes <= 0 {
+		minBytes = 1024
+	}
+	if !param.EnableRequestGzip || len(data) < minBytes {
+		return data, false, nil
+	}
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, false, fmt.Errorf("failed to gzip request body: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, false, fmt.Errorf("failed to gzip request body: %w", err)
+	}
+	return buffer.Bytes(), true, nil
+}
+
+// 记录读取的字节数，用于统计压缩后的响应体大小
+type countingReader struct {
+	reader io.Reader
+	count  int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += n
+	return n, err
+}
+
+type gzipBody struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (body *gzipBody) Close() error {
+	return body.closer.Close()
+}
+
+/*
+解压 gzip 响应体，解压后删除 Content-Encoding，重复调用不会重复解压
+Transport 已经自动解压或者响应没有压缩时返回 nil，否则返回记录压缩后字节数的 countingReader
+*/
+func decodeContentEncoding(resp *http.Response) (*countingReader, error) {
+	if resp.Uncompressed || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return nil, nil
+	}
+	counter := &countingReader{reader: resp.Body}
+	reader, err := gzip.NewReader(counter)
+	if err != nil {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("failed to decode gzip response: %w", err)
+	}
+	resp.Body = &gzipBody{Reader: reader, closer: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return counter, nil
+}
@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestCompressRequestBodyThreshold(t *testing.T) {
+	tests := []struct {
+		name     string
+		param    beans.CompressionParam
+		size     int
+		compress bool
+	}{
+		{name: "disabled", param: beans.CompressionParam{RequestGzipMinBytes: 1}, size: 2048},
+		{name: "below default threshold", param: beans.CompressionParam{EnableRequestGzip: true}, size: 1023},
+		{name: "at default threshold", param: beans.CompressionParam{EnableRequestGzip: true}, size: 1024, compress: true},
+		{name: "below custom threshold", param: beans.CompressionParam{EnableRequestGzip: true, RequestGzipMinBytes: 100}, size: 99},
+		{name: "at custom threshold", param: beans.CompressionParam{EnableRequestGzip: true, RequestGzipMinBytes: 100}, size: 100, compress: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := bytes.Repeat([]byte("a"), test.size)
+			body, compressed, err := compressRequestBody(data, test.param)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if compressed != test.compress {
+				t.Fatalf("compressed = %v, want %v", compressed, test.compress)
+			}
+			if !compressed {
+				if !bytes.Equal(body, data) {
+					t.Fatal("uncompressed body should be sent as is")
+				}
+				return
+			}
+			reader, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := ioutil.ReadAll(reader)
+			if err != nil || !bytes.Equal(decoded, data) {
+				t.Fatalf("decoded body differs, err = %v", err)
+			}
+		})
+	}
+}
+
+func TestRequestCompressionAndObservation(t *testing.T) {
+	responseBody := []byte(cassetteTestBody)
+	gzipResponse := gzipBytes(t, responseBody)
+	var requestEncoding, acceptEncoding string
+	var requestBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requestEncoding = request.Header.Get("Content-Encoding")
+		acceptEncoding = request.Header.Get("Accept-Encoding")
+		requestBody, _ = ioutil.ReadAll(request.Body)
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Content-Encoding", "gzip")
+		_, _ = writer.Write(gzipResponse)
+	}))
+	defer server.Close()
+
+	var observations []beans.RequestObservation
+	config := RequestConfig{
+		CompressionParam: beans.CompressionParam{EnableRequestGzip: true, RequestGzipMinBytes: 10, EnableResponseGzip: true},
+		OnRequestObserved: func(observation beans.RequestObservation) {
+			observations = append(observations, observation)
+		},
+	}
+	params := map[string]interface{}{"login_id": strings.Repeat("user", 100)}
+	response, rawBody, err := RequestExperimentContext(context.Background(), server.URL, params, time.Second, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 请求体被压缩并声明 Content-Encoding，响应体由 SDK 解压
+	if requestEncoding != "gzip" || acceptEncoding != "gzip" {
+		t.Fatalf("Content-Encoding = %q, Accept-Encoding = %q", requestEncoding, acceptEncoding)
+	}
+	if rawBody != string(responseBody) || len(response.Results) != 1 {
+		t.Fatalf("unexpected decoded response %q", rawBody)
+	}
+	if len(observations) != 1 {
+		t.Fatalf("expected 1 observation, got %d", len(observations))
+	}
+	observation := observations[0]
+	if observation.RequestWireBytes != len(requestBody) || observation.RequestWireBytes >= observation.RequestBytes {
+		t.Fatalf("request bytes = %d, wire bytes = %d, sent %d", observation.RequestBytes, observation.RequestWireBytes, len(requestBody))
+	}
+	if observation.ResponseBytes != len(responseBody) || observation.ResponseWireBytes != len(gzipResponse) {
+		t.Fatalf("response bytes = %d, wire bytes = %d, want %d and %d",
+			observation.ResponseBytes, observation.ResponseWireBytes, len(responseBody), len(gzipResponse))
+	}
+	if observation.StatusCode != http.StatusOK || observation.Err != nil {
+		t.Fatalf("status = %d, err = %v", observation.StatusCode, observation.Err)
+	}
+}
+
+func TestRequestWithoutCompression(t *testing.T) {
+	var requestEncoding string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requestEncoding = request.Header.Get("Content-Encoding")
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(cassetteTestBody))
+	}))
+	defer server.Close()
+
+	var observation beans.RequestObservation
+	config := RequestConfig{
+		CompressionParam:  beans.CompressionParam{EnableRequestGzip: true},
+		OnRequestObserved: func(o beans.RequestObservation) { observation = o },
+	}
+	if _, _, err := RequestExperimentContext(context.Background(), server.URL, map[string]interface{}{"login_id": "user"}, time.Second, config); err != nil {
+		t.Fatal(err)
+	}
+	// 请求体小于阈值时不压缩，未压缩的响应体线上字节数等于响应体大小
+	if requestEncoding != "" || observation.RequestWireBytes != observation.RequestBytes {
+		t.Fatalf("Content-Encoding = %q, request bytes = %d, wire bytes = %d", requestEncoding, observation.RequestBytes, observation.RequestWireBytes)
+	}
+	if observation.ResponseBytes != len(cassetteTestBody) || observation.ResponseWireBytes != len(cassetteTestBody) {
+		t.Fatalf("response bytes = %d, wire bytes = %d", observation.ResponseBytes, observation.ResponseWireBytes)
+	}
+}
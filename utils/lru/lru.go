@@ -100,6 +100,20 @@ func (c *Cache) Remove(key Key) {
 	}
 }
 
+// Resize changes MaxEntries without clearing the cache. If the cache
+// holds more than maxEntries items, the oldest items are evicted.
+func (c *Cache) Resize(maxEntries int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.MaxEntries = maxEntries
+	if c.cache == nil || maxEntries == 0 {
+		return
+	}
+	for c.ll.Len() > maxEntries {
+		c.removeOldest()
+	}
+}
+
 // RemoveOldest removes the oldest item from the cache.
 func (c *Cache) removeOldest() {
 	if c.cache == nil {
@@ -144,9 +158,33 @@ func (c *Cache) Clear() {
 	c.cache = nil
 }
 
+// RemoveFunc removes all items for which match returns true and
+// returns the number of removed items.
+func (c *Cache) RemoveFunc(match func(key Key, value interface{}) bool) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.cache == nil {
+		return 0
+	}
+	removed := 0
+	for e := c.ll.Front(); e != nil; {
+		next := e.Next()
+		kv := e.Value.(*entry)
+		if match(kv.key, kv.value) {
+			c.removeElement(e)
+			removed++
+		}
+		e = next
+	}
+	return removed
+}
+
 func (c *Cache) Keys() []interface{} {
 	c.lock.Lock()
 	defer c.lock.Unlock()
+	if c.cache == nil {
+		return nil
+	}
 	keys := make([]interface{}, c.ll.Len())
 	i := 0
 	for _, e := range c.cache {
@@ -2,24 +2,52 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net"
 	"net/http"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/sensorsdata/abtesting-sdk-go/beans"
 )
 
 var httpTransport = &http.Transport{}
+var transportLock = sync.RWMutex{}
+
+// RequestConfig 是单个 SensorsABTest 的请求配置，每次请求时传入，不同的 SensorsABTest 互不影响
+type RequestConfig struct {
+	// 自定义 HTTP 客户端、Header 和签名
+	HTTPClientParam beans.HTTPClientParam
+	// 请求体和响应体的 gzip 压缩
+	CompressionParam beans.CompressionParam
+	// 每次网络请求结束后的回调，为 nil 时不回调
+	OnRequestObserved func(observation beans.RequestObservation)
+	// 响应体大小限制和 Content-Type 校验
+	ResponseParam beans.ResponseParam
+	// 是否打印请求耗时
+	EnableRecordRequestCostTime bool
+}
+
+// InitTransport 替换 HTTP 连接池，正在进行的请求继续使用原来的连接池，原连接池的空闲连接会被关闭
+// TLS 或代理配置不合法时返回错误，并继续使用原来的连接池
+func InitTransport(httpTrans beans.HTTPTransportParam) error {
+	tlsConfig, err := buildTLSConfig(httpTrans)
+	if err != nil {
+		return err
+	}
+	proxy, err := buildProxy(httpTrans.ProxyURL)
+	if err != nil {
+		return err
+	}
 
-func InitTransport(httpTrans beans.HTTPTransportParam) {
-	httpTransport = &http.Transport{
+	transport := &http.Transport{
+		Proxy:           proxy,
+		TLSClientConfig: tlsConfig,
 		DialContext: (&net.Dialer{
 			Timeout:   time.Duration(httpTrans.DialTimeoutMilliSeconds) * time.Millisecond,
 			KeepAlive: time.Duration(httpTrans.DialKeepAliveMilliSeconds) * time.Millisecond,
@@ -29,25 +57,101 @@ func InitTransport(httpTrans beans.HTTPTransportParam) {
 		MaxConnsPerHost:     httpTrans.MaxConnsPerHost,
 		IdleConnTimeout:     time.Duration(httpTrans.IdleConnTimeoutMilliSeconds) * time.Millisecond,
 	}
+
+	transportLock.Lock()
+	oldTransport := httpTransport
+	httpTransport = transport
+	transportLock.Unlock()
+	oldTransport.CloseIdleConnections()
+	return nil
+}
+
+func getTransport() *http.Transport {
+	transportLock.RLock()
+	defer transportLock.RUnlock()
+	return httpTransport
+}
+
+// 优先使用自定义的 Client，其次是自定义的 Transport，都没有设置时使用 SDK 的连接池
+func buildHttpClient(param beans.HTTPClientParam, timeout time.Duration) *http.Client {
+	if param.Client != nil {
+		client := *param.Client
+		client.Timeout = timeout
+		return &client
+	}
+	if param.Transport != nil {
+		return &http.Client{Timeout: timeout, Transport: param.Transport}
+	}
+	return &http.Client{Timeout: timeout, Transport: getTransport()}
+}
+
+// 设置自定义 Header，动态 Header 覆盖静态 Header
+func addCustomHeaders(req *http.Request, param beans.HTTPClientParam) error {
+	for key, value := range param.Headers {
+		req.Header.Set(key, value)
+	}
+	if param.HeaderProvider == nil {
+		return nil
+	}
+	headers, err := param.HeaderProvider()
+	if err != nil {
+		return fmt.Errorf("failed to get request headers: %w", err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return nil
+}
+
+// CloseIdleConnections 关闭 HTTP 连接池中的空闲连接，连接池是全局的，正在进行的请求不受影响
+func CloseIdleConnections() {
+	getTransport().CloseIdleConnections()
 }
 
 // 通用的HTTP请求执行函数，避免重复代码
-func executeHttpRequest(url string, requestParams map[string]interface{}, timeout time.Duration, enableRecordRequestCostTime bool) (*http.Response, error) {
+func executeHttpRequest(ctx context.Context, url string, requestParams map[string]interface{}, timeout time.Duration, config RequestConfig, observation *beans.RequestObservation) (*http.Response, error) {
 	data, err := json.Marshal(requestParams)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request params: %w", err)
 	}
+	compression := config.CompressionParam
+	body, compressed, err := compressRequestBody(data, compression)
+	if err != nil {
+		return nil, err
+	}
+	observation.RequestBytes = len(data)
+	observation.RequestWireBytes = len(body)
 
-	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
+	clientParam := config.HTTPClientParam
+	err = addCustomHeaders(req, clientParam)
+	if err != nil {
+		return nil, err
+	}
+
 	abRequestStartTime := time.Now().UnixNano() / int64(time.Millisecond)
-	req.Header.Add("X-AB-Request-Start-Time", fmt.Sprintf("%v", abRequestStartTime))
-	req.Header.Add("Content-Type", "application/json")
+	req.Header.Set("X-AB-Request-Start-Time", fmt.Sprintf("%v", abRequestStartTime))
+	req.Header.Set("Content-Type", "application/json")
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	// 显式设置 Accept-Encoding 后 Transport 不会自动解压，由 processHttpResponse 解压
+	if compression.EnableResponseGzip {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	if clientParam.Signer != nil {
+		err = clientParam.Signer.Sign(req, body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign request: %w", err)
+		}
+	}
 
-	client := &http.Client{Timeout: timeout, Transport: httpTransport}
+	client := buildHttpClient(clientParam, timeout)
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
@@ -57,21 +161,63 @@ func executeHttpRequest(url string, requestParams map[string]interface{}, timeou
 		return nil, fmt.Errorf("response is nil")
 	}
 
-	if enableRecordRequestCostTime {
+	if config.EnableRecordRequestCostTime {
 		recordRequestCostTime(resp, abRequestStartTime)
 	}
 
 	return resp, nil
 }
 
-// 统一的实验请求函数，返回解析后的实验响应和原始响应体字符串
+// 统一的实验请求函数，返回解析后的实验响应和原始响应体字符串，使用默认的请求配置
 func RequestExperiment(url string, requestParams map[string]interface{}, timeout time.Duration, enableRecordRequestCostTime bool) (Response, string, error) {
-	resp, err := executeHttpRequest(url, requestParams, timeout, enableRecordRequestCostTime)
+	return RequestExperimentContext(context.Background(), url, requestParams, timeout, RequestConfig{EnableRecordRequestCostTime: enableRecordRequestCostTime})
+}
+
+// RequestExperimentContext 使用 config 发送请求，ctx 结束时取消正在进行的请求
+func RequestExperimentContext(ctx context.Context, url string, requestParams map[string]interface{}, timeout time.Duration, config RequestConfig) (Response, string, error) {
+	// 回放模式下不发送网络请求
+	activeCassette := getCassette()
+	if activeCassette != nil && activeCassette.param.Mode == beans.CassetteModeReplay {
+		resp, err := activeCassette.replay(requestParams)
+		if err != nil {
+			return Response{}, "", err
+		}
+		return processResponse(resp, config.ResponseParam)
+	}
+
+	observation := beans.RequestObservation{URL: url}
+	startTime := time.Now()
+	defer func() {
+		observation.Duration = time.Since(startTime)
+		if config.OnRequestObserved != nil {
+			config.OnRequestObserved(observation)
+		}
+	}()
+
+	resp, err := executeHttpRequest(ctx, url, requestParams, timeout, config, &observation)
 	if err != nil {
+		observation.Err = err
 		return Response{}, "", err
 	}
+	observation.StatusCode = resp.StatusCode
+
+	if activeCassette != nil && activeCassette.param.Mode == beans.CassetteModeRecord {
+		resp, err = activeCassette.record(url, requestParams, resp, config.ResponseParam)
+		if err != nil {
+			observation.Err = err
+			return Response{}, "", err
+		}
+	}
 
-	return processResponse(resp)
+	rawBodyStr, err := processHttpResponse(resp, config.ResponseParam, &observation)
+	if err != nil {
+		observation.Err = err
+		return Response{}, rawBodyStr, err
+	}
+	experimentResponse, err := ParseResponse(rawBodyStr)
+	observation.InvalidExperiments = experimentResponse.InvalidExperiments
+	observation.Err = err
+	return experimentResponse, rawBodyStr, err
 }
 
 func truncateBody(arr []byte, maxLen int) string {
@@ -82,8 +228,13 @@ func truncateBody(arr []byte, maxLen int) string {
 	return bodyStr
 }
 
-// 通用的响应处理函数，读取并验证HTTP响应
-func processHttpResponse(resp *http.Response) (string, error) {
+// 通用的响应处理函数，按 param 读取并验证HTTP响应，gzip 压缩的响应体会被解压
+// observation 不为空时记录响应体大小
+func processHttpResponse(resp *http.Response, param beans.ResponseParam, observation *beans.RequestObservation) (string, error) {
+	counter, err := decodeContentEncoding(resp)
+	if err != nil {
+		return "", err
+	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
@@ -91,23 +242,35 @@ func processHttpResponse(resp *http.Response) (string, error) {
 		}
 	}(resp.Body)
 
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := readBoundedBody(resp.Body, param)
 	if err != nil {
 		return "", err
 	}
+	if observation != nil {
+		observation.ResponseBytes = len(body)
+		if counter != nil {
+			observation.ResponseWireBytes = counter.count
+		} else if !resp.Uncompressed {
+			observation.ResponseWireBytes = len(body)
+		}
+	}
 
 	bodyStr := string(body)
 
 	if !isStatusCodeValid(resp.StatusCode) {
-		return bodyStr, fmt.Errorf("response status code is not valid, status code: %d, response: %s", resp.StatusCode, truncateBody(body, 200))
+		return bodyStr, &StatusError{StatusCode: resp.StatusCode, Body: truncateBody(body, 200)}
+	}
+	err = checkContentType(resp.Header, param)
+	if err != nil {
+		return bodyStr, err
 	}
 
 	return bodyStr, nil
 }
 
 // 返回解析后的实验响应和原始响应体字符串的处理函数
-func processResponse(resp *http.Response) (Response, string, error) {
-	rawBodyStr, err := processHttpResponse(resp)
+func processResponse(resp *http.Response, param beans.ResponseParam) (Response, string, error) {
+	rawBodyStr, err := processHttpResponse(resp, param, nil)
 	if err != nil {
 		return Response{}, rawBodyStr, err
 	}
@@ -122,6 +285,27 @@ func recordRequestCostTime(resp *http.Response, abRequestStartTime int64) {
 	recordAbRequestCostTime(resp, abRequestStartTime, abRequestEndTime)
 }
 
+// StatusError 表示分流接口返回了非 2xx 的状态码
+type StatusError struct {
+	StatusCode int
+	// 截断后的响应体
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("response status code is not valid, status code: %d, response: %s", e.StatusCode, e.Body)
+}
+
+// IsRetryableError 判断请求失败后是否可以重试，只有网络错误、429 和 5xx 响应可以重试
+func IsRetryableError(err error) bool {
+	var statusError *StatusError
+	if errors.As(err, &statusError) {
+		return statusError.StatusCode == http.StatusTooManyRequests || statusError.StatusCode >= 500
+	}
+	var netError net.Error
+	return errors.As(err, &netError)
+}
+
 func isStatusCodeValid(statusCode int) bool {
 	return statusCode >= 200 && statusCode <= 299
 }
@@ -156,54 +340,6 @@ func getAbRequestProcessTimeFromResponse(response *http.Response) (abRequestProc
 	return "unknown (not found)"
 }
 
-func defaultTrackConfig(response *Response, resMaps map[string]interface{}) {
-	if !response.TrackConfig.TriggerSwitch {
-		return
-	}
-	trackExt := response.TrackConfig.TriggerContentExt
-
-	// 查找 result 试验组
-	if resMaps["results"] != nil {
-		results := resMaps["results"].([]interface{})
-		for _, result := range results {
-			// 查找第一个试验
-			value := result.(map[string]interface{})
-			for _, extConfig := range trackExt {
-				if value[extConfig] != nil {
-					updateExtValue(response.Results, value["abtest_experiment_id"].(string), extConfig, value[extConfig].(string), len(trackExt))
-				}
-			}
-		}
-	}
-
-	// 查找 out_list 试验组
-	if resMaps["out_list"] != nil {
-		outlists := resMaps["out_list"].([]interface{})
-		for _, result := range outlists {
-			// 查找第一个试验
-			value := result.(map[string]interface{})
-			for _, extConfig := range trackExt {
-				if value[extConfig] != nil {
-					updateExtValue(response.OutList, value["abtest_experiment_id"].(string), extConfig, value[extConfig].(string), len(trackExt))
-				}
-			}
-		}
-	}
-}
-
-func updateExtValue(innerExperiments []beans.InnerExperiment, experimentId string, ext string, extValue string, configCount int) {
-	for index, innerExperiment := range innerExperiments {
-		if innerExperiment.AbtestExperimentId == experimentId {
-			if innerExperiment.TrackExtValue == nil {
-				innerExperiment.TrackExtValue = make(map[string]interface{}, configCount)
-			}
-			innerExperiment.TrackExtValue["$"+ext] = extValue
-			innerExperiments[index] = innerExperiment
-			break
-		}
-	}
-}
-
 type Response struct {
 	Status      string                  `json:"status"`
 	ErrorType   string                  `json:"error_type"`
@@ -211,37 +347,80 @@ type Response struct {
 	Results     []beans.InnerExperiment `json:"results"`
 	TrackConfig beans.TrackConfig       `json:"track_config"`
 	OutList     []beans.InnerExperiment `json:"out_list"`
+	// 校验失败被丢弃的试验，不会出现在 Results 和 OutList 中
+	InvalidExperiments []beans.InvalidExperiment `json:"-"`
 }
 
-// 从原始响应体字符串解析实验响应
-func ParseResponse(rawBodyStr string) (Response, error) {
-	experimentResponse := Response{}
-	var responseMaps map[string]interface{}
-
-	bodyBytes := []byte(rawBodyStr)
+// 响应中没有 track_config 时使用的默认值
+func defaultTrackConfig() beans.TrackConfig {
+	return beans.TrackConfig{
+		ItemSwitch:        false,
+		TriggerSwitch:     true,
+		PropertySetSwitch: false,
+		TriggerContentExt: []string{"abtest_experiment_result_id", "abtest_experiment_version"},
+	}
+}
 
-	err := json.Unmarshal(bodyBytes, &experimentResponse)
-	if err != nil {
+/*
+从原始响应体字符串解析实验响应，响应体只解析一次，track_config 保留原始值用于判断是否存在
+试验的原始字段只在解析期间保留，用于读取 track_config 中的 ext 字段
+单个试验不是对象或者字段类型错误时记入 InvalidExperiments，其他试验正常返回
+*/
+func ParseResponse(rawBodyStr string) (Response, error) {
+	var rawResponse struct {
+		Response
+		Results     []beans.RawExperiment `json:"results"`
+		OutList     []beans.RawExperiment `json:"out_list"`
+		TrackConfig json.RawMessage       `json:"track_config"`
+	}
+	if err := json.Unmarshal([]byte(rawBodyStr), &rawResponse); err != nil {
 		return Response{}, err
 	}
+	experimentResponse := rawResponse.Response
+	if experimentResponse.Status != "SUCCESS" {
+		return Response{}, errors.New(experimentResponse.Error)
+	}
 
-	err = json.Unmarshal(bodyBytes, &responseMaps)
-	if err != nil {
+	if rawResponse.TrackConfig == nil {
+		experimentResponse.TrackConfig = defaultTrackConfig()
+	} else if err := json.Unmarshal(rawResponse.TrackConfig, &experimentResponse.TrackConfig); err != nil {
 		return Response{}, err
 	}
+	var trackExt []string
+	if experimentResponse.TrackConfig.TriggerSwitch {
+		trackExt = experimentResponse.TrackConfig.TriggerContentExt
+	}
+	var invalidResults, invalidOutList []beans.InvalidExperiment
+	experimentResponse.Results, invalidResults = applyTrackContentExt("results", rawResponse.Results, trackExt)
+	experimentResponse.OutList, invalidOutList = applyTrackContentExt("out_list", rawResponse.OutList, trackExt)
+	dropInvalidExperiments(&experimentResponse, append(invalidResults, invalidOutList...))
+	return experimentResponse, nil
+}
 
-	if experimentResponse.Status == "SUCCESS" {
-		if !strings.Contains(rawBodyStr, "track_config") {
-			experimentResponse.TrackConfig = beans.TrackConfig{
-				ItemSwitch:        false,
-				TriggerSwitch:     true,
-				PropertySetSwitch: false,
-				TriggerContentExt: []string{"abtest_experiment_result_id", "abtest_experiment_version"},
-			}
+// 读取 ext 字段后转为 InnerExperiment，解析失败的试验单独返回；响应中没有该列表时返回 nil
+func applyTrackContentExt(list string, rawExperiments []beans.RawExperiment, trackExt []string) ([]beans.InnerExperiment, []beans.InvalidExperiment) {
+	if rawExperiments == nil {
+		return nil, nil
+	}
+	var invalid []beans.InvalidExperiment
+	experiments := make([]beans.InnerExperiment, 0, len(rawExperiments))
+	for index := range rawExperiments {
+		if reason := rawExperiments[index].InvalidReason; reason != "" {
+			invalid = append(invalid, beans.InvalidExperiment{List: list, Experiment: rawExperiments[index].InnerExperiment, Reason: reason})
+			continue
 		}
-		defaultTrackConfig(&experimentResponse, responseMaps)
-		return experimentResponse, nil
-	} else {
-		return Response{}, errors.New(experimentResponse.Error)
+		experiments = append(experiments, rawExperiments[index].ApplyTrackContentExt(trackExt))
+	}
+	return experiments, invalid
+}
+
+// 丢弃校验失败的试验，避免进入缓存，decodeFailures 是解析阶段已经丢弃的试验
+func dropInvalidExperiments(response *Response, decodeFailures []beans.InvalidExperiment) {
+	var invalidResults, invalidOutList []beans.InvalidExperiment
+	response.Results, invalidResults = filterValidExperiments("results", response.Results)
+	response.OutList, invalidOutList = filterValidExperiments("out_list", response.OutList)
+	response.InvalidExperiments = append(append(decodeFailures, invalidResults...), invalidOutList...)
+	for _, invalid := range response.InvalidExperiments {
+		fmt.Println("drop invalid experiment in", invalid.List, ", experimentId:", invalid.Experiment.AbtestExperimentId, ", reason:", invalid.Reason)
 	}
 }
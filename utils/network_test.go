@@ -0,0 +1,291 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+// 不使用 InnerExperiment.UnmarshalJSON，按照 struct tag 解析
+type legacyExperiment beans.InnerExperiment
+
+type legacyResponse struct {
+	Status      string             `json:"status"`
+	ErrorType   string             `json:"error_type"`
+	Error       string             `json:"error"`
+	Results     []legacyExperiment `json:"results"`
+	TrackConfig beans.TrackConfig  `json:"track_config"`
+	OutList     []legacyExperiment `json:"out_list"`
+}
+
+func legacyExperiments(experiments []legacyExperiment) []beans.InnerExperiment {
+	if experiments == nil {
+		return nil
+	}
+	converted := make([]beans.InnerExperiment, len(experiments))
+	for index, experiment := range experiments {
+		converted[index] = beans.InnerExperiment(experiment)
+	}
+	return converted
+}
+
+// 单次解析之前的 ParseResponse：响应体解析两次，第二次解析为 map 读取 ext 字段
+func parseResponseLegacy(rawBodyStr string) (Response, error) {
+	var decoded legacyResponse
+	var responseMaps map[string]interface{}
+
+	bodyBytes := []byte(rawBodyStr)
+
+	err := json.Unmarshal(bodyBytes, &decoded)
+	if err != nil {
+		return Response{}, err
+	}
+
+	err = json.Unmarshal(bodyBytes, &responseMaps)
+	if err != nil {
+		return Response{}, err
+	}
+
+	experimentResponse := Response{
+		Status:      decoded.Status,
+		ErrorType:   decoded.ErrorType,
+		Error:       decoded.Error,
+		Results:     legacyExperiments(decoded.Results),
+		TrackConfig: decoded.TrackConfig,
+		OutList:     legacyExperiments(decoded.OutList),
+	}
+	if experimentResponse.Status == "SUCCESS" {
+		if !strings.Contains(rawBodyStr, "track_config") {
+			experimentResponse.TrackConfig = defaultTrackConfig()
+		}
+		legacyTrackConfig(&experimentResponse, responseMaps)
+		dropInvalidExperiments(&experimentResponse, nil)
+		return experimentResponse, nil
+	}
+	return Response{}, errors.New(experimentResponse.Error)
+}
+
+func legacyTrackConfig(response *Response, resMaps map[string]interface{}) {
+	if !response.TrackConfig.TriggerSwitch {
+		return
+	}
+	trackExt := response.TrackConfig.TriggerContentExt
+	for _, list := range []struct {
+		key         string
+		experiments []beans.InnerExperiment
+	}{{"results", response.Results}, {"out_list", response.OutList}} {
+		if resMaps[list.key] == nil {
+			continue
+		}
+		for _, result := range resMaps[list.key].([]interface{}) {
+			value := result.(map[string]interface{})
+			for _, extConfig := range trackExt {
+				if value[extConfig] != nil {
+					legacyUpdateExtValue(list.experiments, value["abtest_experiment_id"].(string), extConfig, value[extConfig].(string), len(trackExt))
+				}
+			}
+		}
+	}
+}
+
+func legacyUpdateExtValue(innerExperiments []beans.InnerExperiment, experimentId string, ext string, extValue string, configCount int) {
+	for index, innerExperiment := range innerExperiments {
+		if innerExperiment.AbtestExperimentId == experimentId {
+			if innerExperiment.TrackExtValue == nil {
+				innerExperiment.TrackExtValue = make(map[string]interface{}, configCount)
+			}
+			innerExperiment.TrackExtValue["$"+ext] = extValue
+			innerExperiments[index] = innerExperiment
+			break
+		}
+	}
+}
+
+// 生成 FetchAll 响应，results 和 out_list 中的 ext 字段都是字符串
+func buildFetchAllBody(resultCount int, outListCount int, trackConfig string) string {
+	experiment := func(list string, index int) string {
+		return fmt.Sprintf(`{"abtest_experiment_id":"%[1]s_%[2]d","abtest_experiment_group_id":"%[2]d","abtest_experiment_result_id":"%[1]s_result_%[2]d",`+
+			`"abtest_experiment_version":"%[2]d","experiment_type":"CODE","subject_name":"USER","subject_id":"user_%[2]d","stickiness":"STICKY",`+
+			`"cacheable":true,"is_control_group":false,"is_white_list":%[3]v,"custom_ext":"ext_%[2]d",`+
+			`"variables":[{"name":"color_%[2]d","value":"red","type":"STRING"},{"name":"size_%[2]d","value":"%[2]d","type":"INTEGER"},`+
+			`{"name":"enabled_%[2]d","value":"true","type":"BOOLEAN"},{"name":"config_%[2]d","value":"{\"a\":1}","type":"JSON"}]}`, list, index, index%2 == 0)
+	}
+	var builder strings.Builder
+	builder.WriteString(`{"status":"SUCCESS","results":[`)
+	for i := 0; i < resultCount; i++ {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteString(experiment("result", i))
+	}
+	builder.WriteString(`],"out_list":[`)
+	for i := 0; i < outListCount; i++ {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteString(experiment("out", i))
+	}
+	builder.WriteString("]")
+	if trackConfig != "" {
+		builder.WriteString(`,"track_config":` + trackConfig)
+	}
+	builder.WriteString("}")
+	return builder.String()
+}
+
+func TestParseResponseMatchesLegacy(t *testing.T) {
+	cases := map[string]string{
+		"default track_config": buildFetchAllBody(5, 3, ""),
+		"custom ext":           buildFetchAllBody(5, 3, `{"trigger_switch":true,"trigger_content_ext":["abtest_experiment_result_id","custom_ext","missing"]}`),
+		"trigger off":          buildFetchAllBody(5, 3, `{"trigger_switch":false,"trigger_content_ext":["custom_ext"]}`),
+		"null track_config":    buildFetchAllBody(5, 3, `null`),
+		"empty lists":          `{"status":"SUCCESS","results":[],"out_list":[]}`,
+		"missing lists":        `{"status":"SUCCESS"}`,
+		"invalid experiment":   `{"status":"SUCCESS","results":[{"abtest_experiment_id":"1","abtest_experiment_group_id":"","abtest_experiment_result_id":"2"}]}`,
+		// struct tag 解析不区分字段名的大小写
+		"mixed case keys": `{"status":"SUCCESS","results":[{"abtest_experiment_id":"1","ABTEST_EXPERIMENT_GROUP_ID":"0","Abtest_Experiment_Result_Id":"2",` +
+			`"IS_CONTROL_GROUP":true,"Variables":[{"NAME":"color","value":"red","type":"STRING"}],"result":"kept"}]}`,
+		"failed status": `{"status":"FAILED","error":"project not found"}`,
+	}
+	for name, body := range cases {
+		t.Run(name, func(t *testing.T) {
+			want, wantErr := parseResponseLegacy(body)
+			got, err := ParseResponse(body)
+			if (err == nil) != (wantErr == nil) || (err != nil && err.Error() != wantErr.Error()) {
+				t.Fatalf("error = %v, legacy error = %v", err, wantErr)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("response differs from legacy\n got: %+v\nwant: %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseResponseTrackExtValue(t *testing.T) {
+	response, err := ParseResponse(buildFetchAllBody(1, 1, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有 track_config 时默认记录 result_id 和 version
+	want := map[string]interface{}{"$abtest_experiment_result_id": "result_result_0", "$abtest_experiment_version": "0"}
+	if !reflect.DeepEqual(response.Results[0].TrackExtValue, want) {
+		t.Fatalf("TrackExtValue = %v", response.Results[0].TrackExtValue)
+	}
+	if !reflect.DeepEqual(response.TrackConfig, defaultTrackConfig()) {
+		t.Fatalf("TrackConfig = %+v", response.TrackConfig)
+	}
+
+	response, err = ParseResponse(buildFetchAllBody(1, 1, `null`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.TrackConfig.TriggerSwitch || response.Results[0].TrackExtValue != nil {
+		t.Fatalf("null track_config should disable tracking: %+v", response)
+	}
+}
+
+func BenchmarkParseResponse(b *testing.B) {
+	body := buildFetchAllBody(200, 50, `{"trigger_switch":true,"trigger_content_ext":["abtest_experiment_result_id","abtest_experiment_version","custom_ext"]}`)
+	b.Run("legacy", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+		for i := 0; i < b.N; i++ {
+			if _, err := parseResponseLegacy(body); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("single_pass", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+		for i := 0; i < b.N; i++ {
+			if _, err := ParseResponse(body); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestParseResponseDropsMalformedExperiments(t *testing.T) {
+	body := `{"status":"SUCCESS","track_config":{"trigger_switch":true,"trigger_content_ext":["abtest_experiment_version","flag","detail"]},` +
+		`"results":[` +
+		`{"abtest_experiment_id":"1","abtest_experiment_group_id":0,"abtest_experiment_result_id":"1_result","abtest_experiment_version":3,"flag":true,"detail":{"a":1}},` +
+		`{"abtest_experiment_id":{"a":1},"abtest_experiment_group_id":"0","abtest_experiment_result_id":"2_result"},` +
+		`1,` +
+		`{"abtest_experiment_id":"3","abtest_experiment_group_id":"0","abtest_experiment_result_id":"3_result","cacheable":"yes"},` +
+		`{"abtest_experiment_id":"4","abtest_experiment_group_id":"0","abtest_experiment_result_id":"4_result"}],` +
+		`"out_list":[{"abtest_experiment_id":"5","abtest_experiment_group_id":"0","abtest_experiment_result_id":["5_result"]}]}`
+	response, err := ParseResponse(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Results) != 2 || response.Results[0].AbtestExperimentId != "1" || response.Results[1].AbtestExperimentId != "4" {
+		t.Fatalf("results = %+v", response.Results)
+	}
+	if len(response.OutList) != 0 {
+		t.Fatalf("out_list = %+v", response.OutList)
+	}
+	// 数字和布尔值转为字符串，对象跳过
+	want := map[string]interface{}{"$abtest_experiment_version": "3", "$flag": "true"}
+	if !reflect.DeepEqual(response.Results[0].TrackExtValue, want) || response.Results[0].AbtestExperimentGroupId != "0" {
+		t.Fatalf("experiment 1 = %+v", response.Results[0])
+	}
+
+	var reasons []string
+	for _, invalid := range response.InvalidExperiments {
+		reasons = append(reasons, invalid.List+": "+invalid.Reason)
+	}
+	wantReasons := []string{
+		"results: invalid field abtest_experiment_id of experiment: expected string, got object",
+		"results: experiment must be an object, got number",
+		"results: invalid field cacheable of experiment: json: cannot unmarshal string into Go value of type bool",
+		"out_list: invalid field abtest_experiment_result_id of experiment: expected string, got array",
+	}
+	if !reflect.DeepEqual(reasons, wantReasons) {
+		t.Fatalf("invalid experiments = %q", reasons)
+	}
+}
+
+func FuzzParseResponse(f *testing.F) {
+	seeds := []string{
+		buildFetchAllBody(1, 0, ""),
+		buildFetchAllBody(1, 0, `null`),
+		`{"status":"SUCCESS","track_config":{"trigger_switch":true,"trigger_content_ext":["custom_ext"]},"results":[{"abtest_experiment_id":"1","abtest_experiment_group_id":"0","abtest_experiment_result_id":"2","custom_ext":12.50}]}`,
+		`{"status":"SUCCESS","track_config":{"trigger_switch":true,"trigger_content_ext":["custom_ext"]},"results":[{"abtest_experiment_id":"1","abtest_experiment_group_id":"0","abtest_experiment_result_id":"2","custom_ext":false}]}`,
+		`{"status":"SUCCESS","track_config":{"trigger_switch":true,"trigger_content_ext":["custom_ext"]},"out_list":[{"abtest_experiment_id":"1","abtest_experiment_group_id":"0","abtest_experiment_result_id":"2","custom_ext":{"a":[1]}}]}`,
+		`{"status":"SUCCESS","results":[{"abtest_experiment_id":{"a":1},"abtest_experiment_group_id":["0"],"abtest_experiment_result_id":2}]}`,
+		`{"status":"SUCCESS","results":{"abtest_experiment_id":"1"}}`,
+		`{"status":"SUCCESS","results":"1","out_list":1}`,
+		`{"status":"SUCCESS","results":[1,"x",null,[]],"track_config":null}`,
+		`{"status":"FAILED","error":"project not found"}`,
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, body string) {
+		response, err := ParseResponse(body)
+		if err != nil {
+			return
+		}
+		for _, experiment := range append(append([]beans.InnerExperiment(nil), response.Results...), response.OutList...) {
+			if reason := validateExperiment(experiment); reason != "" {
+				t.Fatalf("invalid experiment %+v returned: %s", experiment, reason)
+			}
+			for key, value := range experiment.TrackExtValue {
+				if _, ok := value.(string); !ok {
+					t.Fatalf("ext %s = %#v, expected string", key, value)
+				}
+			}
+		}
+		for _, invalid := range response.InvalidExperiments {
+			if invalid.Reason == "" {
+				t.Fatalf("dropped experiment without reason: %+v", invalid)
+			}
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter 按照固定间隔放行请求，用于限制批量请求对 A/B Testing 服务的压力
+type RateLimiter struct {
+	interval time.Duration
+	lock     sync.Mutex
+	next     time.Time
+}
+
+// NewRateLimiter 创建每秒最多放行 requestsPerSecond 个请求的限流器，requestsPerSecond <= 0 时返回 nil，表示不限流
+func NewRateLimiter(requestsPerSecond float64) *RateLimiter {
+	if requestsPerSecond <= 0 {
+		return nil
+	}
+	return &RateLimiter{interval: time.Duration(float64(time.Second) / requestsPerSecond)}
+}
+
+// Wait 阻塞到允许发送下一个请求，ctx 结束时返回 ctx 的错误
+func (limiter *RateLimiter) Wait(ctx context.Context) error {
+	if limiter == nil {
+		return ctx.Err()
+	}
+	limiter.lock.Lock()
+	now := time.Now()
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+	wait := limiter.next.Sub(now)
+	limiter.next = limiter.next.Add(limiter.interval)
+	limiter.lock.Unlock()
+
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
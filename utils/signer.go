@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+// HMACHeaderLayout 声明签名相关的 Header，为空的字段使用默认值
+type HMACHeaderLayout struct {
+	// 签名，默认 X-AB-Signature
+	Signature string
+	// 签名时间戳，单位 ms，默认 X-AB-Timestamp
+	Timestamp string
+	// 密钥 ID，服务端据此选择密钥，默认 X-AB-Key-Id；设置为 "-" 时不发送
+	KeyId string
+	// 签名值的前缀，例如 "HMAC-SHA256 "，默认为空
+	SignaturePrefix string
+}
+
+// HMACSigner 使用 HMAC-SHA256 对 method、path、时间戳和请求体签名
+// 签名内容为 METHOD + "\n" + PATH + "\n" + TIMESTAMP + "\n" + BODY，签名值为小写 hex
+type HMACSigner struct {
+	layout HMACHeaderLayout
+	// 签名时间戳的时钟，测试时替换
+	now func() time.Time
+
+	lock   sync.RWMutex
+	keyId  string
+	secret []byte
+}
+
+var _ beans.RequestSigner = (*HMACSigner)(nil)
+
+// NewHMACSigner 创建 HMACSigner，密钥轮换时调用 Rotate
+func NewHMACSigner(keyId string, secret []byte, layout HMACHeaderLayout) (*HMACSigner, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("HMAC secret must not be empty")
+	}
+	if layout.Signature == "" {
+		layout.Signature = "X-AB-Signature"
+	}
+	if layout.Timestamp == "" {
+		layout.Timestamp = "X-AB-Timestamp"
+	}
+	if layout.KeyId == "" {
+		layout.KeyId = "X-AB-Key-Id"
+	}
+	return &HMACSigner{
+		layout: layout,
+		now:    time.Now,
+		keyId:  keyId,
+		secret: append([]byte(nil), secret...),
+	}, nil
+}
+
+// Rotate 替换签名密钥，之后发送的请求使用新的密钥签名
+func (signer *HMACSigner) Rotate(keyId string, secret []byte) error {
+	if len(secret) == 0 {
+		return errors.New("HMAC secret must not be empty")
+	}
+	signer.lock.Lock()
+	defer signer.lock.Unlock()
+	signer.keyId = keyId
+	signer.secret = append([]byte(nil), secret...)
+	return nil
+}
+
+func (signer *HMACSigner) Sign(req *http.Request, body []byte) error {
+	signer.lock.RLock()
+	keyId := signer.keyId
+	secret := signer.secret
+	signer.lock.RUnlock()
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	timestamp := strconv.FormatInt(signer.now().UnixNano()/int64(time.Millisecond), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(req.Method + "\n" + path + "\n" + timestamp + "\n"))
+	mac.Write(body)
+
+	req.Header.Set(signer.layout.Timestamp, timestamp)
+	if signer.layout.KeyId != "-" && keyId != "" {
+		req.Header.Set(signer.layout.KeyId, keyId)
+	}
+	req.Header.Set(signer.layout.Signature, signer.layout.SignaturePrefix+hex.EncodeToString(mac.Sum(nil)))
+	return nil
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func signTestRequest(t *testing.T, signer *HMACSigner) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest("POST", "http://ab.example.com/api/v2/abtest/online/results", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = signer.Sign(req, []byte(`{"login_id":"u"}`)); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func newTestSigner(t *testing.T, layout HMACHeaderLayout) *HMACSigner {
+	t.Helper()
+	signer, err := NewHMACSigner("key-1", []byte("secret-1"), layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer.now = func() time.Time { return time.Unix(1700000000, 0) }
+	return signer
+}
+
+func TestHMACSignerKnownAnswer(t *testing.T) {
+	// HMAC-SHA256("secret-1", "POST\n/api/v2/abtest/online/results\n1700000000000\n{\"login_id\":\"u\"}")
+	const signature = "de7edb963d327eb6ccc91c4c6e477b0714f7a99bdf4c2cd734af44cb437db3a4"
+	tests := []struct {
+		name   string
+		layout HMACHeaderLayout
+		want   map[string]string
+	}{
+		{
+			name: "default layout",
+			want: map[string]string{
+				"X-AB-Signature": signature,
+				"X-AB-Timestamp": "1700000000000",
+				"X-AB-Key-Id":    "key-1",
+			},
+		},
+		{
+			name:   "custom layout",
+			layout: HMACHeaderLayout{Signature: "Authorization", Timestamp: "X-Time", KeyId: "-", SignaturePrefix: "HMAC-SHA256 "},
+			want: map[string]string{
+				"Authorization": "HMAC-SHA256 " + signature,
+				"X-Time":        "1700000000000",
+				"X-AB-Key-Id":   "",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := signTestRequest(t, newTestSigner(t, test.layout))
+			for header, want := range test.want {
+				if got := req.Header.Get(header); got != want {
+					t.Fatalf("%s = %q, want %q", header, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHMACSignerRotate(t *testing.T) {
+	signer := newTestSigner(t, HMACHeaderLayout{})
+	if err := signer.Rotate("key-2", nil); err == nil {
+		t.Fatal("expected error for empty secret")
+	}
+	if err := signer.Rotate("key-2", []byte("secret-2")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 轮换后的下一次请求使用新的密钥 ID 和密钥
+	req := signTestRequest(t, signer)
+	if keyId := req.Header.Get("X-AB-Key-Id"); keyId != "key-2" {
+		t.Fatalf("X-AB-Key-Id = %q", keyId)
+	}
+	const want = "ba36508dcf4d5224107b6cafb468333a2e83a851dde652be51a25b9b93a2cbef"
+	if signature := req.Header.Get("X-AB-Signature"); signature != want {
+		t.Fatalf("X-AB-Signature = %q, want %q", signature, want)
+	}
+}
+
+func TestNewHMACSignerRejectsEmptySecret(t *testing.T) {
+	if _, err := NewHMACSigner("key-1", nil, HMACHeaderLayout{}); err == nil {
+		t.Fatal("expected error for empty secret")
+	}
+}
@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+// 证书文件的检查间隔，避免每次建立连接都读取文件
+const certCheckInterval = time.Second
+
+// 根据 HTTPTransportParam 构建 TLS 配置，没有 TLS 相关的配置时返回 nil，使用系统默认配置
+func buildTLSConfig(param beans.HTTPTransportParam) (*tls.Config, error) {
+	if param.CAFile == "" && param.CertFile == "" && param.KeyFile == "" && !param.InsecureSkipVerifyForTestingOnly {
+		return nil, nil
+	}
+	if (param.CertFile == "") != (param.KeyFile == "") {
+		return nil, errors.New("CertFile and KeyFile must be set together")
+	}
+
+	reloader := &certReloader{caFile: param.CAFile, certFile: param.CertFile, keyFile: param.KeyFile}
+	err := reloader.load()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if param.CertFile != "" {
+		config.GetClientCertificate = reloader.getClientCertificate
+	}
+	if param.InsecureSkipVerifyForTestingOnly {
+		fmt.Println("WARNING: TLS certificate verification of the A/B Testing API is disabled, do not use InsecureSkipVerifyForTestingOnly in production")
+		config.InsecureSkipVerify = true
+	} else if param.CAFile != "" {
+		// CA 证书轮换后无法修改 RootCAs，由 verifyConnection 使用最新的 CA 证书完成与默认流程相同的校验
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = reloader.verifyConnection
+	}
+	return config, nil
+}
+
+// 解析代理地址，支持 http、https 和 socks5
+func buildProxy(proxyURL string) (func(*http.Request) (*url.URL, error), error) {
+	if proxyURL == "" {
+		return nil, nil
+	}
+	parsedURL, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ProxyURL: %w", err)
+	}
+	switch parsedURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid ProxyURL %s, scheme must be http, https or socks5", proxyURL)
+	}
+	if parsedURL.Host == "" {
+		return nil, fmt.Errorf("invalid ProxyURL %s, host must not be empty", proxyURL)
+	}
+	return http.ProxyURL(parsedURL), nil
+}
+
+// 证书文件修改后重新加载，加载失败时继续使用原来的证书
+type certReloader struct {
+	caFile   string
+	certFile string
+	keyFile  string
+
+	lock        sync.Mutex
+	lastCheck   time.Time
+	modTime     time.Time
+	rootCAs     *x509.CertPool
+	certificate *tls.Certificate
+}
+
+func (reloader *certReloader) load() error {
+	modTime, err := reloader.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	var rootCAs *x509.CertPool
+	if reloader.caFile != "" {
+		data, err := ioutil.ReadFile(reloader.caFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CAFile: %w", err)
+		}
+		rootCAs = x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no PEM certificate found in CAFile %s", reloader.caFile)
+		}
+	}
+
+	var certificate *tls.Certificate
+	if reloader.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		certificate = &cert
+	}
+
+	reloader.modTime = modTime
+	reloader.rootCAs = rootCAs
+	reloader.certificate = certificate
+	return nil
+}
+
+func (reloader *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{reloader.caFile, reloader.certFile, reloader.keyFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return latest, fmt.Errorf("failed to stat certificate file: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// 检查证书文件是否修改，修改后重新加载
+func (reloader *certReloader) current() (*x509.CertPool, *tls.Certificate) {
+	reloader.lock.Lock()
+	defer reloader.lock.Unlock()
+	if time.Since(reloader.lastCheck) >= certCheckInterval {
+		reloader.lastCheck = time.Now()
+		modTime, err := reloader.latestModTime()
+		if err == nil && !modTime.Equal(reloader.modTime) {
+			err = reloader.load()
+		}
+		if err != nil {
+			fmt.Println("reload certificate failed, keep using the previous certificate, error : ", err)
+		}
+	}
+	return reloader.rootCAs, reloader.certificate
+}
+
+func (reloader *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	_, certificate := reloader.current()
+	return certificate, nil
+}
+
+func (reloader *certReloader) verifyConnection(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("server did not provide a certificate")
+	}
+	rootCAs, _ := reloader.current()
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       state.ServerName,
+		Roots:         rootCAs,
+		Intermediates: intermediates,
+	})
+	return err
+}
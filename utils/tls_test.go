@@ -0,0 +1,230 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+// 生成自签名证书，返回证书和私钥的 PEM 文件路径
+func writeTestCert(t *testing.T, dir string, name string) (string, string, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+func writePEM(t *testing.T, path string, blockType string, der []byte) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 使用 param 构建的 TLS 配置请求 url
+func getWithTLS(t *testing.T, param beans.HTTPTransportParam, url string) error {
+	t.Helper()
+	config, err := buildTLSConfig(param)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}, Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+func TestBuildTLSConfigPrivateCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+	defer server.Close()
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", server.Certificate().Raw)
+	otherCAFile, _, _ := writeTestCert(t, dir, "other")
+
+	if config, err := buildTLSConfig(beans.HTTPTransportParam{}); err != nil || config != nil {
+		t.Fatalf("expected the default TLS config, got %v, %v", config, err)
+	}
+	if err := getWithTLS(t, beans.HTTPTransportParam{}, server.URL); err == nil {
+		t.Fatal("private CA should not be trusted by default")
+	}
+	if err := getWithTLS(t, beans.HTTPTransportParam{CAFile: caFile}, server.URL); err != nil {
+		t.Fatalf("private CA should be trusted: %v", err)
+	}
+	// 只信任 CAFile 中的证书，不使用系统证书
+	if err := getWithTLS(t, beans.HTTPTransportParam{CAFile: otherCAFile}, server.URL); err == nil {
+		t.Fatal("server signed by another CA should be rejected")
+	}
+}
+
+func TestBuildTLSConfigInsecure(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+	defer server.Close()
+	if err := getWithTLS(t, beans.HTTPTransportParam{InsecureSkipVerifyForTestingOnly: true}, server.URL); err != nil {
+		t.Fatalf("insecure mode should skip verification: %v", err)
+	}
+}
+
+func TestBuildTLSConfigClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, clientCert := writeTestCert(t, dir, "client")
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	var peerName string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		peerName = request.TLS.PeerCertificates[0].Subject.CommonName
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	caFile := filepath.Join(dir, "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", server.Certificate().Raw)
+
+	if err := getWithTLS(t, beans.HTTPTransportParam{CAFile: caFile}, server.URL); err == nil {
+		t.Fatal("server requires a client certificate")
+	}
+	err := getWithTLS(t, beans.HTTPTransportParam{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}, server.URL)
+	if err != nil || peerName != "client" {
+		t.Fatalf("mTLS request failed: %v, peer = %q", err, peerName)
+	}
+
+	if _, err = buildTLSConfig(beans.HTTPTransportParam{CertFile: certFile}); err == nil {
+		t.Fatal("CertFile without KeyFile should be rejected")
+	}
+	if _, err = buildTLSConfig(beans.HTTPTransportParam{CAFile: keyFile}); err == nil {
+		t.Fatal("CAFile without a certificate should be rejected")
+	}
+}
+
+func TestCertReloaderReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, _ := writeTestCert(t, dir, "first")
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.load(); err != nil {
+		t.Fatal(err)
+	}
+	commonName := func() string {
+		t.Helper()
+		certificate, err := reloader.getClientCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(certificate.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert.Subject.CommonName
+	}
+	if name := commonName(); name != "first" {
+		t.Fatalf("certificate = %s", name)
+	}
+	// 跳过检查间隔，模拟文件修改
+	touch := func(modTime time.Time) {
+		t.Helper()
+		for _, path := range []string{certFile, keyFile} {
+			if err := os.Chtimes(path, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		reloader.lock.Lock()
+		reloader.lastCheck = time.Time{}
+		reloader.lock.Unlock()
+	}
+
+	secondCert, secondKey, _ := writeTestCert(t, dir, "second")
+	for source, target := range map[string]string{secondCert: certFile, secondKey: keyFile} {
+		data, err := ioutil.ReadFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(target, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	touch(time.Now().Add(time.Minute))
+	if name := commonName(); name != "second" {
+		t.Fatalf("certificate should be reloaded, got %s", name)
+	}
+
+	// 新的证书文件不合法时继续使用原来的证书
+	if err := ioutil.WriteFile(certFile, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	touch(time.Now().Add(2 * time.Minute))
+	if name := commonName(); name != "second" {
+		t.Fatalf("broken certificate should not replace the previous one, got %s", name)
+	}
+}
+
+func TestBuildProxy(t *testing.T) {
+	tests := []struct {
+		proxyURL string
+		valid    bool
+	}{
+		{proxyURL: "", valid: true},
+		{proxyURL: "http://proxy.example.com:3128", valid: true},
+		{proxyURL: "https://proxy.example.com", valid: true},
+		{proxyURL: "socks5://127.0.0.1:1080", valid: true},
+		{proxyURL: "ftp://proxy.example.com"},
+		{proxyURL: "proxy.example.com:3128"},
+		{proxyURL: "http://"},
+		{proxyURL: "http://[::1"},
+	}
+	for _, test := range tests {
+		proxy, err := buildProxy(test.proxyURL)
+		if (err == nil) != test.valid {
+			t.Errorf("%q: err = %v", test.proxyURL, err)
+			continue
+		}
+		if !test.valid || test.proxyURL == "" {
+			continue
+		}
+		request, _ := http.NewRequest("GET", "http://ab.example.com", nil)
+		if proxyURL, err := proxy(request); err != nil || proxyURL.String() != test.proxyURL {
+			t.Errorf("%q: proxy = %v, %v", test.proxyURL, proxyURL, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+const defaultMaxResponseBytes = 10 << 20
+
+// ResponseTooLargeError 表示响应体超过了 ResponseParam.MaxBytes
+type ResponseTooLargeError struct {
+	Limit int
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("response body exceeds the limit of %d bytes", e.Limit)
+}
+
+// 最多读取 MaxBytes 字节，超过时返回 ResponseTooLargeError
+func readBoundedBody(body io.Reader, param beans.ResponseParam) ([]byte, error) {
+	limit := param.MaxBytes
+	if limit <= 0 {
+		limit = defaultMaxResponseBytes
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(body, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, &ResponseTooLargeError{Limit: limit}
+	}
+	return data, nil
+}
+
+// 只接受 application/json 和 +json 结尾的类型，没有 Content-Type 时不校验
+func checkContentType(header http.Header, param beans.ResponseParam) error {
+	contentType := header.Get("Content-Type")
+	if param.SkipContentTypeCheck || contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) {
+		return nil
+	}
+	return errors.New("unexpected response Content-Type: " + contentType)
+}
+
+// 变量类型，与 castValue 支持的类型一致
+var knownVariableTypes = map[string]bool{
+	"STRING":  true,
+	"JSON":    true,
+	"INTEGER": true,
+	"BOOLEAN": true,
+}
+
+// 校验试验，返回保留的试验和被丢弃的试验
+func filterValidExperiments(list string, experiments []beans.InnerExperiment) ([]beans.InnerExperiment, []beans.InvalidExperiment) {
+	var invalid []beans.InvalidExperiment
+	valid := experiments[:0]
+	for _, experiment := range experiments {
+		reason := validateExperiment(experiment)
+		if reason != "" {
+			invalid = append(invalid, beans.InvalidExperiment{List: list, Experiment: experiment, Reason: reason})
+			continue
+		}
+		valid = append(valid, experiment)
+	}
+	return valid, invalid
+}
+
+func validateExperiment(experiment beans.InnerExperiment) string {
+	if experiment.AbtestExperimentId == "" {
+		return "empty abtest_experiment_id"
+	}
+	if experiment.AbtestExperimentGroupId == "" {
+		return "empty abtest_experiment_group_id"
+	}
+	if experiment.AbtestExperimentResultId == "" {
+		return "empty abtest_experiment_result_id"
+	}
+	for _, variable := range experiment.VariableList {
+		if !knownVariableTypes[variable.Type] {
+			return "unknown type " + variable.Type + " of variable " + variable.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sensorsdata/abtesting-sdk-go/beans"
+)
+
+func newResponseServer(contentType string, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if contentType != "" {
+			writer.Header().Set("Content-Type", contentType)
+		}
+		_, _ = writer.Write([]byte(body))
+	}))
+}
+
+func TestReadBoundedBody(t *testing.T) {
+	tests := []struct {
+		name  string
+		param beans.ResponseParam
+		size  int
+		limit int
+	}{
+		{name: "at limit", param: beans.ResponseParam{MaxBytes: 10}, size: 10},
+		{name: "over limit", param: beans.ResponseParam{MaxBytes: 10}, size: 11, limit: 10},
+		{name: "default limit", size: defaultMaxResponseBytes},
+		{name: "over default limit", size: defaultMaxResponseBytes + 1, limit: defaultMaxResponseBytes},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := readBoundedBody(strings.NewReader(strings.Repeat("a", test.size)), test.param)
+			if test.limit == 0 {
+				if err != nil || len(data) != test.size {
+					t.Fatalf("read %d bytes, err = %v", len(data), err)
+				}
+				return
+			}
+			var tooLarge *ResponseTooLargeError
+			if !errors.As(err, &tooLarge) || tooLarge.Limit != test.limit {
+				t.Fatalf("expected ResponseTooLargeError with limit %d, got %v", test.limit, err)
+			}
+		})
+	}
+}
+
+func TestCheckContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		param       beans.ResponseParam
+		valid       bool
+	}{
+		{contentType: "", valid: true},
+		{contentType: "application/json", valid: true},
+		{contentType: "application/json; charset=utf-8", valid: true},
+		{contentType: "application/problem+json", valid: true},
+		{contentType: "text/html", valid: false},
+		{contentType: "text/plain; charset=utf-8", valid: false},
+		{contentType: "not a media type", valid: false},
+		{contentType: "text/html", param: beans.ResponseParam{SkipContentTypeCheck: true}, valid: true},
+	}
+	for _, test := range tests {
+		header := http.Header{}
+		if test.contentType != "" {
+			header.Set("Content-Type", test.contentType)
+		}
+		if err := checkContentType(header, test.param); (err == nil) != test.valid {
+			t.Errorf("Content-Type %q, skip %v: err = %v", test.contentType, test.param.SkipContentTypeCheck, err)
+		}
+	}
+}
+
+func TestRequestRejectsInvalidResponse(t *testing.T) {
+	params := map[string]interface{}{"login_id": "user"}
+	large := newResponseServer("application/json", cassetteTestBody)
+	defer large.Close()
+	html := newResponseServer("text/html", "<html></html>")
+	defer html.Close()
+
+	// 超过限制的响应体返回 ResponseTooLargeError
+	config := RequestConfig{ResponseParam: beans.ResponseParam{MaxBytes: 16}}
+	_, _, err := RequestExperimentContext(context.Background(), large.URL, params, time.Second, config)
+	var tooLarge *ResponseTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != 16 {
+		t.Fatalf("expected ResponseTooLargeError, got %v", err)
+	}
+	if _, _, err = RequestExperimentContext(context.Background(), large.URL, params, time.Second, RequestConfig{}); err != nil {
+		t.Fatalf("response within the default limit should be accepted, got %v", err)
+	}
+
+	// 非 JSON 的 Content-Type 被拒绝，SkipContentTypeCheck 时不校验
+	_, _, err = RequestExperimentContext(context.Background(), html.URL, params, time.Second, RequestConfig{})
+	if err == nil || !strings.Contains(err.Error(), "Content-Type") {
+		t.Fatalf("expected Content-Type error, got %v", err)
+	}
+	config = RequestConfig{ResponseParam: beans.ResponseParam{SkipContentTypeCheck: true}}
+	_, _, err = RequestExperimentContext(context.Background(), html.URL, params, time.Second, config)
+	if err == nil || strings.Contains(err.Error(), "Content-Type") {
+		t.Fatalf("expected a parse error instead of a Content-Type error, got %v", err)
+	}
+}
+
+func TestCassetteRecordRejectsOversizedBody(t *testing.T) {
+	server := newResponseServer("application/json", cassetteTestBody)
+	defer server.Close()
+	defer func() { _ = InitCassette(beans.CassetteParam{}) }()
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+	if err := InitCassette(beans.CassetteParam{Mode: beans.CassetteModeRecord, Path: path}); err != nil {
+		t.Fatal(err)
+	}
+
+	config := RequestConfig{ResponseParam: beans.ResponseParam{MaxBytes: 16}}
+	_, _, err := RequestExperimentContext(context.Background(), server.URL, map[string]interface{}{"login_id": "user"}, time.Second, config)
+	var tooLarge *ResponseTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("expected ResponseTooLargeError while recording, got %v", err)
+	}
+}